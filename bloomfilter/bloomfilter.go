@@ -1,11 +1,29 @@
 package bloomfilter
 
-import "github.com/YzmjY/toykv/x"
+import (
+	"fmt"
+
+	"github.com/YzmjY/toykv/x"
+)
 
 type FilterPoliy interface {
 	Name() string
+	// Params 返回构造过滤器的参数，与Name一起记录在table中，用于读取时还原policy
+	Params() (bitsPerKey uint64, k uint64)
 	AppendFilter(keys [][]byte, dst []byte) []byte
 	KeyMayMatch(key []byte, filter []byte) bool
+	// NewBuilder 返回一个可以逐个添加key的FilterBuilder
+	NewBuilder() FilterBuilder
+}
+
+// FilterBuilder 流式构造过滤器，只保存key的hash而不保存key本身，
+// 使得构造table时内存占用与key的长度无关
+type FilterBuilder interface {
+	AddKey(key []byte)
+	// EstimatedSize Finish之后过滤器大约占用的字节数
+	EstimatedSize() int
+	// Finish 把过滤器追加到dst之后，并重置builder以便复用
+	Finish(dst []byte) []byte
 }
 
 type BloomFilterPoliy struct {
@@ -30,28 +48,83 @@ func NewBloomFilterPoliy(bitsPerKey uint64) FilterPoliy {
 	}
 }
 
+const bloomFilterName = "toykv.bloomfilter"
+
+func init() {
+	Register(bloomFilterName, newBloomFilterPoliyWithParams)
+}
+
+// newBloomFilterPoliyWithParams 根据table中记录的参数还原policy
+func newBloomFilterPoliyWithParams(bitsPerKey, k uint64) (FilterPoliy, error) {
+	if bitsPerKey == 0 || k == 0 || k > 30 {
+		return nil, fmt.Errorf("bloomfilter: invalid params bitsPerKey=%d k=%d", bitsPerKey, k)
+	}
+
+	return &BloomFilterPoliy{
+		bitsPerKey: bitsPerKey,
+		k:          k,
+	}, nil
+}
+
 func (*BloomFilterPoliy) Name() string {
-	return "toykv.bloomfilter"
+	return bloomFilterName
+}
+
+func (b *BloomFilterPoliy) Params() (uint64, uint64) {
+	return b.bitsPerKey, b.k
 }
 
 func (b *BloomFilterPoliy) AppendFilter(keys [][]byte, dst []byte) []byte {
-	keysHash := make([]uint32, len(keys))
-	for idx, key := range keys {
-		keysHash[idx] = Hash(key)
+	fb := b.NewBuilder()
+	for _, key := range keys {
+		fb.AddKey(key)
 	}
 
-	return b.appendFilterHash(keysHash, dst)
+	return fb.Finish(dst)
 }
 
-func (b *BloomFilterPoliy) appendFilterHash(keysHash []uint32, dst []byte) []byte {
-	nKeys := len(keysHash)
-	nBits := nKeys * int(b.bitsPerKey)
+func (b *BloomFilterPoliy) NewBuilder() FilterBuilder {
+	return &bloomFilterBuilder{policy: b}
+}
+
+// bloomFilterBuilder 只保存每个key的32位hash
+type bloomFilterBuilder struct {
+	policy   *BloomFilterPoliy
+	keysHash []uint32
+}
+
+func (fb *bloomFilterBuilder) AddKey(key []byte) {
+	h := Hash(key)
+	if n := len(fb.keysHash); n > 0 && fb.keysHash[n-1] == h {
+		// 有序添加时，同一个userKey的多个版本是相邻的
+		return
+	}
+	fb.keysHash = append(fb.keysHash, h)
+}
+
+func (fb *bloomFilterBuilder) EstimatedSize() int {
+	return bloomFilterSize(len(fb.keysHash), fb.policy.bitsPerKey) + 1
+}
+
+func (fb *bloomFilterBuilder) Finish(dst []byte) []byte {
+	dst = fb.policy.appendFilterHash(fb.keysHash, dst)
+	fb.keysHash = fb.keysHash[:0]
+	return dst
+}
+
+// bloomFilterSize nKeys个key的位图占用的字节数，不包括末尾记录k的一个字节
+func bloomFilterSize(nKeys int, bitsPerKey uint64) int {
+	nBits := nKeys * int(bitsPerKey)
 	if nBits < 64 {
 		nBits = 64
 	}
 
-	nBytes := (nBits + 7) / 8
-	nBits = nBytes * 8
+	return (nBits + 7) / 8
+}
+
+func (b *BloomFilterPoliy) appendFilterHash(keysHash []uint32, dst []byte) []byte {
+	nBytes := bloomFilterSize(len(keysHash), b.bitsPerKey)
+	nBits := nBytes * 8
 
 	c := len(dst)
 	dst = extend(dst, nBytes+1)
@@ -99,6 +172,8 @@ func extend(dst []byte, need int) []byte {
 		copy(ans, dst)
 	} else {
 		ans = dst[:len(dst)+need]
+		// 复用的buffer中可能残留旧数据
+		clear(ans[len(dst):])
 	}
 
 	return ans
@@ -1,7 +1,11 @@
 package bloomfilter
 
 import (
+	"bytes"
+	"fmt"
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 type _xx []byte
@@ -147,3 +151,32 @@ func TestHash(t *testing.T) {
 		}
 	}
 }
+
+func TestFilterBuilder(t *testing.T) {
+	for _, f := range []FilterPoliy{NewBloomFilterPoliy(10), NewRosettaFilterPoliy(10)} {
+		var keys [][]byte
+		for i := 0; i < 1000; i++ {
+			keys = append(keys, []byte(fmt.Sprintf("prefix/%d/%05d", i/100, i)))
+		}
+		want := f.AppendFilter(keys, nil)
+
+		fb := f.NewBuilder()
+		for round := 0; round < 2; round++ {
+			for _, key := range keys {
+				fb.AddKey(key)
+				// 同一个userKey的多个版本
+				fb.AddKey(key)
+			}
+			require.GreaterOrEqual(t, fb.EstimatedSize(), len(want)/2, f.Name())
+
+			// dst中残留的数据不能影响结果
+			dst := bytes.Repeat([]byte{0xff}, 8+len(want))
+			got := fb.Finish(dst[:8])
+			require.Equal(t, want, got[8:], f.Name())
+		}
+
+		for _, key := range keys {
+			require.True(t, f.KeyMayMatch(key, want), f.Name())
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package bloomfilter
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// FilterMetrics 过滤器在读路径上的效果统计，可以并发更新
+type FilterMetrics struct {
+	useful        atomic.Uint64 // KeyMayMatch返回false，省掉了一次查找
+	checked       atomic.Uint64 // KeyMayMatch返回true，需要继续查找
+	falsePositive atomic.Uint64 // KeyMayMatch返回true，但key实际并不存在
+}
+
+// RecordMayMatch 记录一次KeyMayMatch的结果
+func (m *FilterMetrics) RecordMayMatch(mayMatch bool) {
+	if mayMatch {
+		m.checked.Add(1)
+	} else {
+		m.useful.Add(1)
+	}
+}
+
+// RecordFalsePositive KeyMayMatch返回true之后，查找发现key不存在时调用
+func (m *FilterMetrics) RecordFalsePositive() {
+	m.falsePositive.Add(1)
+}
+
+func (m *FilterMetrics) Stats() FilterStats {
+	return FilterStats{
+		Useful:        m.useful.Load(),
+		Checked:       m.checked.Load(),
+		FalsePositive: m.falsePositive.Load(),
+	}
+}
+
+// FilterStats FilterMetrics的快照
+type FilterStats struct {
+	Useful        uint64
+	Checked       uint64
+	FalsePositive uint64
+}
+
+func (s FilterStats) add(o FilterStats) FilterStats {
+	return FilterStats{
+		Useful:        s.Useful + o.Useful,
+		Checked:       s.Checked + o.Checked,
+		FalsePositive: s.FalsePositive + o.FalsePositive,
+	}
+}
+
+// FalsePositiveRate 不存在的key中被过滤器误判为存在的比例，用来评估bitsPerKey是否合适
+func (s FilterStats) FalsePositiveRate() float64 {
+	negatives := s.Useful + s.FalsePositive
+	if negatives == 0 {
+		return 0
+	}
+	return float64(s.FalsePositive) / float64(negatives)
+}
+
+type tableID struct {
+	level int
+	id    uint64
+}
+
+// MetricsSet 按level和table组织的过滤器统计
+type MetricsSet struct {
+	mu      sync.Mutex
+	tables  map[tableID]*FilterMetrics
+	retired map[int]FilterStats // 已经删除的table，计入所在level的统计中
+}
+
+func NewMetricsSet() *MetricsSet {
+	return &MetricsSet{
+		tables:  make(map[tableID]*FilterMetrics),
+		retired: make(map[int]FilterStats),
+	}
+}
+
+// ForTable 返回table的统计，不存在时创建
+func (s *MetricsSet) ForTable(level int, id uint64) *FilterMetrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := tableID{level: level, id: id}
+	m, ok := s.tables[key]
+	if !ok {
+		m = &FilterMetrics{}
+		s.tables[key] = m
+	}
+	return m
+}
+
+// RemoveTable table被删除时调用，它的统计会保留在level的统计中
+func (s *MetricsSet) RemoveTable(level int, id uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := tableID{level: level, id: id}
+	m, ok := s.tables[key]
+	if !ok {
+		return
+	}
+	s.retired[level] = s.retired[level].add(m.Stats())
+	delete(s.tables, key)
+}
+
+// Table 返回一个table的统计
+func (s *MetricsSet) Table(level int, id uint64) (FilterStats, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.tables[tableID{level: level, id: id}]
+	if !ok {
+		return FilterStats{}, false
+	}
+	return m.Stats(), true
+}
+
+// Level 返回一个level上所有table（包括已删除的）的统计之和
+func (s *MetricsSet) Level(level int) FilterStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ans := s.retired[level]
+	for key, m := range s.tables {
+		if key.level == level {
+			ans = ans.add(m.Stats())
+		}
+	}
+	return ans
+}
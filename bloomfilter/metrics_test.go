@@ -0,0 +1,37 @@
+package bloomfilter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsSet(t *testing.T) {
+	s := NewMetricsSet()
+
+	m1 := s.ForTable(0, 1)
+	m1.RecordMayMatch(false)
+	m1.RecordMayMatch(false)
+	m1.RecordMayMatch(true)
+	m1.RecordFalsePositive()
+	require.Same(t, m1, s.ForTable(0, 1))
+
+	m2 := s.ForTable(0, 2)
+	m2.RecordMayMatch(true)
+
+	s.ForTable(1, 3).RecordMayMatch(false)
+
+	stats, ok := s.Table(0, 1)
+	require.True(t, ok)
+	require.Equal(t, FilterStats{Useful: 2, Checked: 1, FalsePositive: 1}, stats)
+	require.InDelta(t, 1.0/3, stats.FalsePositiveRate(), 1e-9)
+
+	require.Equal(t, FilterStats{Useful: 2, Checked: 2, FalsePositive: 1}, s.Level(0))
+	require.Equal(t, FilterStats{Useful: 1}, s.Level(1))
+
+	// 删除table后level的统计不变
+	s.RemoveTable(0, 1)
+	_, ok = s.Table(0, 1)
+	require.False(t, ok)
+	require.Equal(t, FilterStats{Useful: 2, Checked: 2, FalsePositive: 1}, s.Level(0))
+}
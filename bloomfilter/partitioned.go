@@ -0,0 +1,194 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/YzmjY/toykv/x"
+)
+
+var errBadPartitionIndex = errors.New("bloomfilter: bad partition index")
+
+// partitionHandle 顶层索引中的一项：分区内最大的key以及分区在data中的位置
+type partitionHandle struct {
+	lastKey []byte
+	offset  uint64
+	size    uint64
+}
+
+// PartitionedFilterBuilder 分区过滤器的构造器。
+// 每blocksPerPartition个data block生成一个filter分区，
+// 顶层索引中记录分区的最后一个key（带时间戳的内部key）和分区的位置。
+type PartitionedFilterBuilder struct {
+	blocksPerPartition int
+
+	filter  FilterBuilder // 当前分区的过滤器
+	nKeys   int           // 当前分区已经添加的key数
+	nBlocks int           // 当前分区已经包含的data block数
+	lastKey []byte
+
+	partitions []partition
+}
+
+// partition 已经切分出的分区
+type partition struct {
+	lastKey []byte
+	filter  []byte
+}
+
+func NewPartitionedFilterBuilder(policy FilterPoliy, blocksPerPartition int) *PartitionedFilterBuilder {
+	x.AssertTrue(blocksPerPartition > 0)
+	return &PartitionedFilterBuilder{
+		blocksPerPartition: blocksPerPartition,
+		filter:             policy.NewBuilder(),
+	}
+}
+
+// Add 添加一个内部key，过滤器中记录的是其userKey。key需要按序添加
+func (b *PartitionedFilterBuilder) Add(key []byte) {
+	b.filter.AddKey(x.ParseUserKey(key))
+	b.nKeys++
+	b.lastKey = append(b.lastKey[:0], key...)
+}
+
+// FinishBlock 每写完一个data block调用一次，满blocksPerPartition个block时切分出一个分区
+func (b *PartitionedFilterBuilder) FinishBlock() {
+	b.nBlocks++
+	if b.nBlocks >= b.blocksPerPartition {
+		b.cutPartition()
+	}
+}
+
+func (b *PartitionedFilterBuilder) cutPartition() {
+	if b.nKeys == 0 {
+		b.nBlocks = 0
+		return
+	}
+
+	b.partitions = append(b.partitions, partition{
+		lastKey: append([]byte(nil), b.lastKey...),
+		filter:  b.filter.Finish(nil),
+	})
+
+	b.nKeys = 0
+	b.nBlocks = 0
+}
+
+// EstimatedSize 目前为止所有分区及顶层索引大约占用的字节数
+func (b *PartitionedFilterBuilder) EstimatedSize() int {
+	size := b.filter.EstimatedSize() + len(b.lastKey)
+	for _, p := range b.partitions {
+		size += len(p.filter) + len(p.lastKey) + 2*binary.MaxVarintLen64
+	}
+	return size
+}
+
+// Finish 返回所有分区拼接而成的data以及顶层索引，索引中记录的是分区在data中的位置
+func (b *PartitionedFilterBuilder) Finish() (data []byte, index []byte) {
+	index, _ = b.FinishWith(func(filter []byte) (uint64, uint64, error) {
+		offset := len(data)
+		data = append(data, filter...)
+		return uint64(offset), uint64(len(filter)), nil
+	})
+	return data, index
+}
+
+// FinishWith 由调用方逐个写出分区，索引中记录write返回的位置，
+// 读取时PartitionLoader会拿到同样的offset和size
+func (b *PartitionedFilterBuilder) FinishWith(write func(filter []byte) (offset, size uint64, err error)) ([]byte, error) {
+	b.cutPartition()
+
+	var index []byte
+	for _, p := range b.partitions {
+		offset, size, err := write(p.filter)
+		if err != nil {
+			return nil, err
+		}
+		index = binary.AppendUvarint(index, uint64(len(p.lastKey)))
+		index = append(index, p.lastKey...)
+		index = binary.AppendUvarint(index, offset)
+		index = binary.AppendUvarint(index, size)
+	}
+
+	b.partitions = nil
+	return index, nil
+}
+
+func decodePartitionIndex(index []byte) ([]partitionHandle, error) {
+	var ans []partitionHandle
+	for len(index) > 0 {
+		var h partitionHandle
+
+		keyLen, n := binary.Uvarint(index)
+		if n <= 0 || uint64(len(index)-n) < keyLen {
+			return nil, errBadPartitionIndex
+		}
+		index = index[n:]
+		h.lastKey = index[:keyLen]
+		index = index[keyLen:]
+
+		if h.offset, n = binary.Uvarint(index); n <= 0 {
+			return nil, errBadPartitionIndex
+		}
+		index = index[n:]
+
+		if h.size, n = binary.Uvarint(index); n <= 0 {
+			return nil, errBadPartitionIndex
+		}
+		index = index[n:]
+
+		ans = append(ans, h)
+	}
+
+	return ans, nil
+}
+
+// PartitionLoader 按需加载一个分区，offset和size是分区在data中（或FinishWith记录）的位置。
+// 调用方一般通过block cache实现
+type PartitionLoader func(offset, size uint64) ([]byte, error)
+
+// PartitionedFilter 分区过滤器的读取端，只有顶层索引常驻内存
+type PartitionedFilter struct {
+	policy     FilterPoliy
+	partitions []partitionHandle
+	load       PartitionLoader
+}
+
+func NewPartitionedFilter(policy FilterPoliy, index []byte, load PartitionLoader) (*PartitionedFilter, error) {
+	partitions, err := decodePartitionIndex(index)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PartitionedFilter{
+		policy:     policy,
+		partitions: partitions,
+		load:       load,
+	}, nil
+}
+
+// NumPartitions 分区个数
+func (f *PartitionedFilter) NumPartitions() int {
+	return len(f.partitions)
+}
+
+// KeyMayMatch key为内部key，找到第一个lastKey大于等于key的分区，用该分区的过滤器判断
+func (f *PartitionedFilter) KeyMayMatch(key []byte) bool {
+	idx := sort.Search(len(f.partitions), func(i int) bool {
+		return x.KeysCompare(f.partitions[i].lastKey, key) >= 0
+	})
+	if idx == len(f.partitions) {
+		// 比所有key都大
+		return false
+	}
+
+	h := f.partitions[idx]
+	filter, err := f.load(h.offset, h.size)
+	if err != nil {
+		// 加载失败时不能给出否定的答案
+		return true
+	}
+
+	return f.policy.KeyMayMatch(x.ParseUserKey(key), filter)
+}
@@ -0,0 +1,60 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/YzmjY/toykv/x"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartitionedFilter(t *testing.T) {
+	const (
+		n             = 10000
+		keysPerBlock  = 100
+		blocksPerPart = 4
+	)
+	key := func(i int) []byte {
+		return x.KeyWithTs([]byte(fmt.Sprintf("key%06d", i)), 1)
+	}
+
+	b := NewPartitionedFilterBuilder(NewBloomFilterPoliy(10), blocksPerPart)
+	for i := 0; i < n; i++ {
+		b.Add(key(i))
+		if (i+1)%keysPerBlock == 0 {
+			b.FinishBlock()
+		}
+	}
+	data, index := b.Finish()
+
+	loads := 0
+	f, err := NewPartitionedFilter(NewBloomFilterPoliy(10), index, func(offset, size uint64) ([]byte, error) {
+		loads++
+		return data[offset : offset+size], nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, n/keysPerBlock/blocksPerPart, f.NumPartitions())
+
+	for i := 0; i < n; i++ {
+		require.True(t, f.KeyMayMatch(key(i)))
+	}
+	require.Equal(t, n, loads)
+
+	// 比所有key都大的key不需要加载任何分区
+	loads = 0
+	require.False(t, f.KeyMayMatch(key(n+1)))
+	require.Equal(t, 0, loads)
+
+	nFalsePositive := 0
+	for i := 0; i < n; i++ {
+		if f.KeyMayMatch(x.KeyWithTs([]byte(fmt.Sprintf("key%06d_", i)), 1)) {
+			nFalsePositive++
+		}
+	}
+	require.Less(t, nFalsePositive, n/50)
+}
+
+func TestPartitionedFilterBadIndex(t *testing.T) {
+	_, err := NewPartitionedFilter(NewBloomFilterPoliy(10), []byte{0x10, 'a'}, nil)
+	require.Error(t, err)
+}
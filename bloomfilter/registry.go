@@ -0,0 +1,98 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var errBadPolicyMeta = errors.New("bloomfilter: bad policy meta")
+
+// PolicyConstructor 根据记录的参数构造policy
+type PolicyConstructor func(bitsPerKey, k uint64) (FilterPoliy, error)
+
+var registry = struct {
+	sync.RWMutex
+	ctors map[string]PolicyConstructor
+}{
+	ctors: make(map[string]PolicyConstructor),
+}
+
+// Register 注册一个policy，name需要与policy.Name()一致，重复注册会panic
+func Register(name string, ctor PolicyConstructor) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := registry.ctors[name]; ok {
+		panic(fmt.Sprintf("bloomfilter: policy %q registered twice", name))
+	}
+	registry.ctors[name] = ctor
+}
+
+// PolicyMeta 记录在table footer中的过滤器描述
+type PolicyMeta struct {
+	Name       string
+	BitsPerKey uint64
+	K          uint64
+}
+
+func MetaOf(p FilterPoliy) PolicyMeta {
+	bitsPerKey, k := p.Params()
+	return PolicyMeta{
+		Name:       p.Name(),
+		BitsPerKey: bitsPerKey,
+		K:          k,
+	}
+}
+
+// Encode 编码格式：
+// | nameLen(uvarint) | name | bitsPerKey(uvarint) | k(uvarint) |
+func (m PolicyMeta) Encode(dst []byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(m.Name)))
+	dst = append(dst, m.Name...)
+	dst = binary.AppendUvarint(dst, m.BitsPerKey)
+	dst = binary.AppendUvarint(dst, m.K)
+	return dst
+}
+
+func DecodePolicyMeta(src []byte) (PolicyMeta, error) {
+	var m PolicyMeta
+
+	nameLen, n := binary.Uvarint(src)
+	if n <= 0 || uint64(len(src)-n) < nameLen {
+		return m, errBadPolicyMeta
+	}
+	src = src[n:]
+	m.Name = string(src[:nameLen])
+	src = src[nameLen:]
+
+	if m.BitsPerKey, n = binary.Uvarint(src); n <= 0 {
+		return m, errBadPolicyMeta
+	}
+	src = src[n:]
+
+	if m.K, n = binary.Uvarint(src); n <= 0 {
+		return m, errBadPolicyMeta
+	}
+
+	return m, nil
+}
+
+// Lookup 还原meta描述的policy。未注册或参数不合法时返回false，
+// 调用方应当跳过该过滤器（视为所有key都可能存在），而不是给出错误的否定答案
+func Lookup(m PolicyMeta) (FilterPoliy, bool) {
+	registry.RLock()
+	ctor, ok := registry.ctors[m.Name]
+	registry.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	p, err := ctor(m.BitsPerKey, m.K)
+	if err != nil {
+		return nil, false
+	}
+
+	return p, true
+}
@@ -0,0 +1,42 @@
+package bloomfilter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyMetaRoundTrip(t *testing.T) {
+	p := NewBloomFilterPoliy(10)
+	meta := MetaOf(p)
+	require.Equal(t, PolicyMeta{Name: "toykv.bloomfilter", BitsPerKey: 10, K: 6}, meta)
+
+	got, err := DecodePolicyMeta(meta.Encode(nil))
+	require.NoError(t, err)
+	require.Equal(t, meta, got)
+
+	restored, ok := Lookup(got)
+	require.True(t, ok)
+
+	filter := p.AppendFilter([][]byte{[]byte("hello"), []byte("world")}, nil)
+	require.True(t, restored.KeyMayMatch([]byte("hello"), filter))
+	require.True(t, restored.KeyMayMatch([]byte("world"), filter))
+	require.False(t, restored.KeyMayMatch([]byte("x"), filter))
+
+	_, err = DecodePolicyMeta(meta.Encode(nil)[:3])
+	require.Error(t, err)
+}
+
+func TestLookupUnknownPolicy(t *testing.T) {
+	_, ok := Lookup(PolicyMeta{Name: "rocksdb.BuiltinBloomFilter", BitsPerKey: 10, K: 6})
+	require.False(t, ok)
+
+	_, ok = Lookup(PolicyMeta{Name: "toykv.bloomfilter", BitsPerKey: 10, K: 0})
+	require.False(t, ok)
+}
+
+func TestRegisterTwice(t *testing.T) {
+	require.Panics(t, func() {
+		Register("toykv.bloomfilter", newBloomFilterPoliyWithParams)
+	})
+}
@@ -0,0 +1,267 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// RangeFilterPoliy 在点查询之外还能回答区间[lo, hi)内是否可能存在key
+type RangeFilterPoliy interface {
+	FilterPoliy
+	// RangeMayMatch hi为nil表示没有上界
+	RangeMayMatch(lo, hi []byte, filter []byte) bool
+}
+
+const (
+	rosettaFilterName = "toykv.rosetta"
+
+	rosettaLevels = 64
+	// 单次区间查询最多探测的次数，超过后保守地返回true
+	rosettaProbeBudget = 2048
+)
+
+// RosettaFilterPoliy 基于前缀布隆过滤器的区间过滤器（Rosetta）。
+// 去掉所有key的公共前缀后，取接下来的8个字节作为一个uint64，
+// 把它在每一层（0~63）的二进制前缀都插入同一个布隆过滤器中。
+// 查询时把区间拆成若干二进制对齐的子区间，自顶向下探测，
+// 上层不存在则整个子区间都不存在，上层存在则继续向下确认。
+//
+// filter格式：
+// | cpLen(uvarint) | commonPrefix | bloom filter |
+type RosettaFilterPoliy struct {
+	bloom *BloomFilterPoliy
+}
+
+var _ RangeFilterPoliy = &RosettaFilterPoliy{}
+
+// NewRosettaFilterPoliy bitsPerKey是每个插入的前缀占用的bit数，
+// 已排序的key在高层前缀上会被去重，所以实际大小通常远小于64*bitsPerKey
+func NewRosettaFilterPoliy(bitsPerKey uint64) RangeFilterPoliy {
+	return &RosettaFilterPoliy{
+		bloom: NewBloomFilterPoliy(bitsPerKey).(*BloomFilterPoliy),
+	}
+}
+
+func init() {
+	Register(rosettaFilterName, func(bitsPerKey, k uint64) (FilterPoliy, error) {
+		bloom, err := newBloomFilterPoliyWithParams(bitsPerKey, k)
+		if err != nil {
+			return nil, err
+		}
+		return &RosettaFilterPoliy{bloom: bloom.(*BloomFilterPoliy)}, nil
+	})
+}
+
+func (*RosettaFilterPoliy) Name() string {
+	return rosettaFilterName
+}
+
+func (r *RosettaFilterPoliy) Params() (uint64, uint64) {
+	return r.bloom.Params()
+}
+
+func (r *RosettaFilterPoliy) AppendFilter(keys [][]byte, dst []byte) []byte {
+	fb := r.NewBuilder()
+	for _, key := range keys {
+		fb.AddKey(key)
+	}
+
+	return fb.Finish(dst)
+}
+
+func (r *RosettaFilterPoliy) NewBuilder() FilterBuilder {
+	return &rosettaFilterBuilder{policy: r}
+}
+
+// rosettaEntry 一个key的定长摘要：与第一个key的公共前缀长度，以及紧随其后的8个字节。
+// 最终的公共前缀长度L不超过任何一个cpl，所以key[L:L+8]可以由first[L:cpl]和tail拼出来
+type rosettaEntry struct {
+	cpl  int
+	tail uint64
+}
+
+// rosettaFilterBuilder 除第一个key外，每个key只保存一个rosettaEntry
+type rosettaFilterBuilder struct {
+	policy *RosettaFilterPoliy
+
+	first   []byte
+	cpLen   int
+	entries []rosettaEntry
+}
+
+func (fb *rosettaFilterBuilder) AddKey(key []byte) {
+	if len(fb.entries) == 0 {
+		fb.first = append(fb.first[:0], key...)
+		fb.cpLen = len(key)
+	}
+
+	cpl := commonPrefixLen(fb.first, key)
+	e := rosettaEntry{cpl: cpl, tail: prefixUint64(key[cpl:])}
+	if n := len(fb.entries); n > 0 && fb.entries[n-1] == e {
+		return
+	}
+
+	fb.entries = append(fb.entries, e)
+	if cpl < fb.cpLen {
+		fb.cpLen = cpl
+	}
+}
+
+func (fb *rosettaFilterBuilder) EstimatedSize() int {
+	// 高层前缀的去重效果在Finish之前无法知道，这里按上限估计
+	return bloomFilterSize(len(fb.entries)*rosettaLevels, fb.policy.bloom.bitsPerKey) + fb.cpLen + 2
+}
+
+func (fb *rosettaFilterBuilder) Finish(dst []byte) []byte {
+	cp := fb.first[:fb.cpLen]
+
+	var (
+		hashes []uint32
+		last   [rosettaLevels]uint64
+		buf    [16]byte
+	)
+	for i, e := range fb.entries {
+		// 还原key[cpLen:cpLen+8]
+		clear(buf[:])
+		n := copy(buf[:8], fb.first[fb.cpLen:e.cpl])
+		binary.BigEndian.PutUint64(buf[n:], e.tail)
+		v := binary.BigEndian.Uint64(buf[:8])
+
+		for level := uint(0); level < rosettaLevels; level++ {
+			prefix := v >> level
+			if i > 0 && last[level] == prefix {
+				// 有序的key在高层上大量重复
+				continue
+			}
+			last[level] = prefix
+			hashes = append(hashes, rosettaHash(level, prefix))
+		}
+	}
+
+	dst = binary.AppendUvarint(dst, uint64(len(cp)))
+	dst = append(dst, cp...)
+	dst = fb.policy.bloom.appendFilterHash(hashes, dst)
+
+	fb.first = fb.first[:0]
+	fb.cpLen = 0
+	fb.entries = fb.entries[:0]
+	return dst
+}
+
+func (r *RosettaFilterPoliy) KeyMayMatch(key []byte, filter []byte) bool {
+	cp, bloom, ok := decodeRosettaFilter(filter)
+	if !ok {
+		return true
+	}
+	if !bytes.HasPrefix(key, cp) {
+		return false
+	}
+
+	return r.bloom.KeyHashMayMatch(rosettaHash(0, prefixUint64(key[len(cp):])), bloom)
+}
+
+func (r *RosettaFilterPoliy) RangeMayMatch(lo, hi []byte, filter []byte) bool {
+	if hi != nil && bytes.Compare(lo, hi) >= 0 {
+		return false
+	}
+
+	cp, bloom, ok := decodeRosettaFilter(filter)
+	if !ok {
+		return true
+	}
+
+	// 所有key都落在以cp为前缀的区间内，把[lo, hi)映射到去掉cp之后的uint64空间
+	var loV, hiV uint64
+	switch {
+	case bytes.HasPrefix(lo, cp):
+		loV = prefixUint64(lo[len(cp):])
+	case bytes.Compare(lo, cp) < 0:
+		loV = 0
+	default:
+		return false
+	}
+
+	switch {
+	case hi == nil:
+		hiV = ^uint64(0)
+	case bytes.Equal(hi, cp):
+		return false
+	case bytes.HasPrefix(hi, cp):
+		// 截断到8字节后，等于hiV的key仍可能小于hi，所以按闭区间查询
+		hiV = prefixUint64(hi[len(cp):])
+	case bytes.Compare(hi, cp) < 0:
+		return false
+	default:
+		hiV = ^uint64(0)
+	}
+
+	budget := rosettaProbeBudget
+	return r.rangeMayMatch(bloom, loV, hiV, rosettaLevels, 0, &budget)
+}
+
+// rangeMayMatch 判断第level层的前缀prefix对应的区间与[lo, hi]的交集中是否可能存在key
+func (r *RosettaFilterPoliy) rangeMayMatch(bloom []byte, lo, hi uint64, level uint, prefix uint64, budget *int) bool {
+	start := prefix << level
+	end := start | (1<<level - 1)
+	if end < lo || start > hi {
+		return false
+	}
+
+	if level < rosettaLevels {
+		if *budget <= 0 {
+			return true
+		}
+		*budget--
+
+		if !r.bloom.KeyHashMayMatch(rosettaHash(level, prefix), bloom) {
+			return false
+		}
+	}
+
+	if level == 0 {
+		return true
+	}
+
+	return r.rangeMayMatch(bloom, lo, hi, level-1, prefix<<1, budget) ||
+		r.rangeMayMatch(bloom, lo, hi, level-1, prefix<<1|1, budget)
+}
+
+func decodeRosettaFilter(filter []byte) (cp []byte, bloom []byte, ok bool) {
+	cpLen, n := binary.Uvarint(filter)
+	if n <= 0 || uint64(len(filter)-n) < cpLen {
+		return nil, nil, false
+	}
+	filter = filter[n:]
+	if len(filter)-int(cpLen) < 2 {
+		return nil, nil, false
+	}
+
+	return filter[:cpLen], filter[cpLen:], true
+}
+
+func rosettaHash(level uint, prefix uint64) uint32 {
+	var buf [9]byte
+	buf[0] = byte(level)
+	binary.BigEndian.PutUint64(buf[1:], prefix)
+	return Hash(buf[:])
+}
+
+// prefixUint64 取前8个字节，不足的补0
+func prefixUint64(b []byte) uint64 {
+	var buf [8]byte
+	copy(buf[:], b)
+	return binary.BigEndian.Uint64(buf[:])
+}
+
+func commonPrefixLen(a, b []byte) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
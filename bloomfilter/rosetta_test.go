@@ -0,0 +1,76 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRosettaRangeFilter(t *testing.T) {
+	// 模拟时序数据：series + 大端时间戳，时间戳之间有空洞
+	key := func(ts uint64) []byte {
+		k := []byte("cpu.usage|")
+		return binary.BigEndian.AppendUint64(k, ts)
+	}
+
+	var keys [][]byte
+	for ts := uint64(0); ts < 1000; ts++ {
+		keys = append(keys, key(100000+ts*1000))
+	}
+
+	f := NewRosettaFilterPoliy(10)
+	filter := f.AppendFilter(keys, nil)
+
+	for _, k := range keys {
+		require.True(t, f.KeyMayMatch(k, filter))
+	}
+
+	// 包含key的区间一定要返回true
+	require.True(t, f.RangeMayMatch(key(0), nil, filter))
+	require.True(t, f.RangeMayMatch(key(100000), key(100001), filter))
+	require.True(t, f.RangeMayMatch(key(100500), key(101001), filter))
+	require.True(t, f.RangeMayMatch([]byte("cpu"), []byte("cpu.z"), filter))
+
+	// 完全落在公共前缀之外的区间
+	require.False(t, f.RangeMayMatch([]byte("a"), []byte("b"), filter))
+	require.False(t, f.RangeMayMatch([]byte("mem"), nil, filter))
+	require.False(t, f.RangeMayMatch(key(200), key(100), filter))
+
+	// 落在空洞中的区间绝大多数应该被过滤掉
+	nFalsePositive := 0
+	for ts := uint64(0); ts < 999; ts++ {
+		lo := 100000 + ts*1000 + 1
+		if f.RangeMayMatch(key(lo), key(lo+998), filter) {
+			nFalsePositive++
+		}
+	}
+	require.Less(t, nFalsePositive, 50)
+
+	// 整体在所有key之后
+	require.False(t, f.RangeMayMatch(key(1<<40), key(1<<41), filter))
+}
+
+func TestRosettaRestoreFromMeta(t *testing.T) {
+	var keys [][]byte
+	for i := 0; i < 100; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%04d", i)))
+	}
+	f := NewRosettaFilterPoliy(12)
+	filter := f.AppendFilter(keys, nil)
+
+	p, ok := Lookup(MetaOf(f))
+	require.True(t, ok)
+	rf, ok := p.(RangeFilterPoliy)
+	require.True(t, ok)
+	require.True(t, rf.RangeMayMatch([]byte("key0010"), []byte("key0011"), filter))
+	require.False(t, rf.RangeMayMatch([]byte("key1"), []byte("key2"), filter))
+}
+
+func TestRosettaEmpty(t *testing.T) {
+	f := NewRosettaFilterPoliy(10)
+	filter := f.AppendFilter(nil, nil)
+	require.False(t, f.KeyMayMatch([]byte("a"), filter))
+	require.False(t, f.RangeMayMatch([]byte("a"), nil, filter))
+}
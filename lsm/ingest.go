@@ -0,0 +1,201 @@
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/YzmjY/toykv/table"
+	"github.com/YzmjY/toykv/vfs"
+	"github.com/YzmjY/toykv/x"
+)
+
+var (
+	ErrIngestOverlap = errors.New("lsm: ingested tables overlap each other")
+	ErrIngestEmpty   = errors.New("lsm: ingested table is empty")
+	// ErrIngestVersion 外部构造的table中key的版本必须为0，导入时统一分配版本
+	ErrIngestVersion = errors.New("lsm: ingested table has non-zero versions")
+	// ErrIngestGlobalVersion IngestOptions.Version必须大于已有的所有版本
+	ErrIngestGlobalVersion = errors.New("lsm: ingest version is not newer than existing versions")
+)
+
+// IngestOptions 导入外部table的选项
+type IngestOptions struct {
+	// Move 导入成功后删除原文件，失败时原文件保持不变
+	Move bool
+	// Version 导入的key使用的全局版本，由调用方从时间戳分配器取得，
+	// 必须大于lv中已有的所有版本，并且不超过x.MaxVersion
+	Version uint64
+}
+
+type ingestFile struct {
+	path     string
+	smallest []byte
+	biggest  []byte
+	size     uint64
+}
+
+// Ingest 把离线构造的table文件原子地加入到lv中，文件放到dir下并分配新的id。
+// 所有文件使用opts.Version作为全局版本，放在不与上层重叠的最低的层。
+// 要么全部导入，要么都不导入。
+//
+// lv中只有已经落盘的table，Ingest不检查memtable。调用方要保证还没有flush的
+// memtable中没有与导入文件重叠的key，有重叠时先flush再导入，
+// 否则memtable中版本更旧的key会遮住导入的key。
+//
+// 文件中key的版本都是0，读取时用TableMeta.Open打开，把版本视为TableMeta.GlobalVersion
+func Ingest(lv *Levels, dir string, paths []string, tableOpts table.Options, opts IngestOptions) ([]*TableMeta, error) {
+	version := opts.Version
+	if err := lv.checkIngestVersion(version); err != nil {
+		return nil, err
+	}
+
+	files := make([]ingestFile, 0, len(paths))
+	for _, path := range paths {
+		f, err := checkIngestFile(path, tableOpts)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return x.KeysCompare(files[i].smallest, files[j].smallest) < 0
+	})
+	for i := 1; i < len(files); i++ {
+		if bytes.Compare(x.ParseUserKey(files[i-1].biggest), x.ParseUserKey(files[i].smallest)) >= 0 {
+			return nil, fmt.Errorf("%w: %s and %s", ErrIngestOverlap, files[i-1].path, files[i].path)
+		}
+	}
+
+	// 先预留id，拷贝文件时不持有锁，不阻塞其他读写
+	firstID := lv.reserveIDs(len(files))
+	fs := tableOpts.FileSystem()
+	for i, f := range files {
+		if err := placeFile(fs, f.path, table.TableFileName(dir, firstID+uint64(i))); err != nil {
+			for j := 0; j < i; j++ {
+				fs.Remove(table.TableFileName(dir, firstID+uint64(j)))
+			}
+			return nil, err
+		}
+	}
+	removePlaced := func() {
+		for i := range files {
+			fs.Remove(table.TableFileName(dir, firstID+uint64(i)))
+		}
+	}
+	// 目录项持久化之后才能加入lv，否则崩溃后lv中的table可能不存在
+	if err := fs.SyncDir(dir); err != nil {
+		removePlaced()
+		return nil, err
+	}
+
+	lv.mu.Lock()
+	// 放置文件时没有持有锁，其间可能加入了版本更大的table
+	if err := lv.checkIngestVersionLocked(version); err != nil {
+		lv.mu.Unlock()
+		removePlaced()
+		return nil, err
+	}
+	metas := make([]*TableMeta, 0, len(files))
+	for i, f := range files {
+		meta := &TableMeta{
+			ID:            firstID + uint64(i),
+			Level:         lv.pickLevelLocked(f.smallest, f.biggest),
+			Smallest:      f.smallest,
+			Biggest:       f.biggest,
+			Size:          f.size,
+			GlobalVersion: version,
+		}
+		lv.addTableLocked(meta, version)
+		metas = append(metas, meta)
+	}
+	lv.mu.Unlock()
+
+	// 所有文件都已经导入，这时才删除原文件
+	if opts.Move {
+		for _, f := range files {
+			fs.Remove(f.path)
+		}
+	}
+	return metas, nil
+}
+
+func (lv *Levels) checkIngestVersion(version uint64) error {
+	lv.mu.RLock()
+	defer lv.mu.RUnlock()
+	return lv.checkIngestVersionLocked(version)
+}
+
+func (lv *Levels) checkIngestVersionLocked(version uint64) error {
+	if version <= lv.maxVersion || version > x.MaxVersion {
+		return fmt.Errorf("%w: %d, max version %d", ErrIngestGlobalVersion, version, lv.maxVersion)
+	}
+	return nil
+}
+
+// checkIngestFile 打开并检查一个外部table
+func checkIngestFile(path string, opts table.Options) (ingestFile, error) {
+	r, err := table.OpenReader(path, opts)
+	if err != nil {
+		return ingestFile{}, err
+	}
+	defer r.Close()
+
+	dels := r.RangeDeletions()
+	if r.KeyCount() == 0 && len(dels) == 0 {
+		return ingestFile{}, fmt.Errorf("%w: %s", ErrIngestEmpty, path)
+	}
+	if r.MaxVersion() != 0 {
+		return ingestFile{}, fmt.Errorf("%w: %s", ErrIngestVersion, path)
+	}
+
+	f := ingestFile{path: path, size: r.Size()}
+	if r.KeyCount() > 0 {
+		// key范围来自外部文件的属性，校验之后才能用于比较
+		for _, k := range [][]byte{r.Smallest(), r.Biggest()} {
+			if _, err := x.ParseInternalKey(k); err != nil {
+				return ingestFile{}, fmt.Errorf("lsm: ingest %s: %w", path, err)
+			}
+		}
+		f.smallest = append([]byte(nil), r.Smallest()...)
+		f.biggest = append([]byte(nil), r.Biggest()...)
+	}
+	// 范围删除也要计入key范围。End不包含在范围内，这里保守地当作包含
+	for _, d := range dels {
+		if d.Version != 0 {
+			return ingestFile{}, fmt.Errorf("%w: %s", ErrIngestVersion, path)
+		}
+		start, end := x.KeyWithTs(d.Start, x.MaxVersion), x.KeyWithTs(d.End, 0)
+		if f.smallest == nil || x.KeysCompare(start, f.smallest) < 0 {
+			f.smallest = start
+		}
+		if f.biggest == nil || x.KeysCompare(end, f.biggest) > 0 {
+			f.biggest = end
+		}
+	}
+	return f, nil
+}
+
+// pickLevelLocked 从上往下找到第一个重叠的层，放在它的上一层；都不重叠时放在最底层。
+// 与L0重叠时放在L0，作为L0中最新的table
+func (lv *Levels) pickLevelLocked(smallest, biggest []byte) int {
+	for level := range lv.levels {
+		if lv.overlapsLocked(level, smallest, biggest) {
+			if level == 0 {
+				return 0
+			}
+			return level - 1
+		}
+	}
+	return len(lv.levels) - 1
+}
+
+// placeFile 把src链接到dst，不支持硬链接时拷贝，src保持不变
+func placeFile(fs vfs.FS, src, dst string) error {
+	if err := fs.Link(src, dst); err == nil {
+		return nil
+	}
+	return vfs.CopyFile(fs, src, dst)
+}
@@ -0,0 +1,196 @@
+package lsm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/YzmjY/toykv/table"
+	"github.com/YzmjY/toykv/vfs"
+	"github.com/YzmjY/toykv/x"
+	"github.com/stretchr/testify/require"
+)
+
+// buildExternal 离线构造一个包含[from, to)的table，版本为ts
+func buildExternal(t *testing.T, from, to int, ts uint64) string {
+	path := filepath.Join(t.TempDir(), fmt.Sprintf("ext-%d-%d.sst", from, to))
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	b := table.NewBuilder(f, table.DefaultOptions())
+	for i := from; i < to; i++ {
+		key := x.KeyWithTs([]byte(fmt.Sprintf("key%06d", i)), ts)
+		require.NoError(t, b.Add(key, x.ValueStruct{Value: []byte(fmt.Sprint(i))}))
+	}
+	require.NoError(t, b.Finish())
+	require.NoError(t, f.Close())
+	return path
+}
+
+func userKeyMeta(id uint64, level, from, to int, ts uint64) *TableMeta {
+	return &TableMeta{
+		ID:       id,
+		Level:    level,
+		Smallest: x.KeyWithTs([]byte(fmt.Sprintf("key%06d", from)), ts),
+		Biggest:  x.KeyWithTs([]byte(fmt.Sprintf("key%06d", to-1)), ts),
+	}
+}
+
+func TestIngest(t *testing.T) {
+	dir := t.TempDir()
+	lv := NewLevels(4)
+	require.NoError(t, lv.AddTable(userKeyMeta(1, 0, 0, 100, 5), 5))
+	require.NoError(t, lv.AddTable(userKeyMeta(2, 2, 200, 300, 3), 3))
+	require.NoError(t, lv.AddTable(userKeyMeta(3, 3, 0, 1000, 1), 1))
+
+	paths := []string{
+		buildExternal(t, 50, 60, 0),     // 与L0重叠
+		buildExternal(t, 250, 260, 0),   // 与L2重叠，放在L1
+		buildExternal(t, 2000, 2100, 0), // 不重叠，放在最底层
+	}
+	metas, err := Ingest(lv, dir, paths, table.DefaultOptions(), IngestOptions{Version: 6})
+	require.NoError(t, err)
+	require.Len(t, metas, 3)
+
+	require.Equal(t, []int{0, 1, 3}, []int{metas[0].Level, metas[1].Level, metas[2].Level})
+	c := table.NewTableCache(dir, 2, table.DefaultOptions())
+	defer c.Close()
+	for i, m := range metas {
+		require.EqualValues(t, 4+i, m.ID)
+		require.EqualValues(t, 6, m.GlobalVersion)
+
+		// 文件链接到了dir中，原文件还在
+		tbl, err := table.OpenReader(table.TableFileName(dir, m.ID), table.DefaultOptions())
+		require.NoError(t, err)
+		require.Equal(t, m.Smallest, tbl.Smallest())
+		require.NoError(t, tbl.Close())
+
+		// 读取时key的版本为全局版本，不会被更低层中的旧版本遮住
+		tbl, err = m.Open(c)
+		require.NoError(t, err)
+		v, err := tbl.Get(x.KeyWithTs(x.ParseUserKey(m.Smallest), 6))
+		require.NoError(t, err)
+		require.EqualValues(t, 6, v.Version)
+		tbl.DecrRef()
+		_, err = os.Stat(paths[i])
+		require.NoError(t, err)
+	}
+	require.EqualValues(t, 6, lv.MaxVersion())
+	require.Len(t, lv.Tables(0), 2)
+	require.Equal(t, metas[0], lv.Tables(0)[1])
+}
+
+func TestIngestRejected(t *testing.T) {
+	dir := t.TempDir()
+	lv := NewLevels(3)
+
+	// 导入的文件之间重叠
+	_, err := Ingest(lv, dir, []string{buildExternal(t, 0, 10, 0), buildExternal(t, 5, 20, 0)}, table.DefaultOptions(), IngestOptions{Version: 1})
+	require.ErrorIs(t, err, ErrIngestOverlap)
+
+	// 带有版本
+	_, err = Ingest(lv, dir, []string{buildExternal(t, 0, 10, 3)}, table.DefaultOptions(), IngestOptions{Version: 1})
+	require.ErrorIs(t, err, ErrIngestVersion)
+
+	_, err = Ingest(lv, dir, []string{buildExternal(t, 0, 0, 0)}, table.DefaultOptions(), IngestOptions{Version: 1})
+	require.ErrorIs(t, err, ErrIngestEmpty)
+
+	// 版本不比已有的新
+	require.NoError(t, lv.AddTable(userKeyMeta(1, 2, 100, 200, 5), 5))
+	for _, version := range []uint64{0, 5, x.MaxVersion + 1} {
+		_, err = Ingest(lv, dir, []string{buildExternal(t, 0, 10, 0)}, table.DefaultOptions(), IngestOptions{Version: version})
+		require.ErrorIs(t, err, ErrIngestGlobalVersion)
+	}
+
+	// 失败时不会留下任何文件
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	require.Empty(t, lv.Tables(0))
+	require.Empty(t, lv.Tables(1))
+	require.Len(t, lv.Tables(2), 1)
+}
+
+func TestIngestMove(t *testing.T) {
+	dir := t.TempDir()
+	lv := NewLevels(2)
+	path := buildExternal(t, 0, 10, 0)
+
+	metas, err := Ingest(lv, dir, []string{path}, table.DefaultOptions(), IngestOptions{Move: true, Version: 1})
+	require.NoError(t, err)
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(table.TableFileName(dir, metas[0].ID))
+	require.NoError(t, err)
+	require.Equal(t, 1, metas[0].Level)
+}
+
+func TestIngestMoveFailure(t *testing.T) {
+	dir := t.TempDir()
+	lv := NewLevels(2)
+	paths := []string{buildExternal(t, 0, 10, 0), buildExternal(t, 20, 30, 0)}
+
+	// 不支持硬链接，第二个文件拷贝时失败
+	fs := vfs.NewFaultFS(vfs.Default)
+	fs.InjectErrors(func(op vfs.Op, name string) bool {
+		return op == vfs.OpLink || (op == vfs.OpCreate && name == table.TableFileName(dir, 2))
+	})
+	opts := table.DefaultOptions()
+	opts.FS = fs
+	_, err := Ingest(lv, dir, paths, opts, IngestOptions{Move: true, Version: 1})
+	require.ErrorIs(t, err, vfs.ErrInjected)
+
+	// 原文件都还在，dir中没有留下文件
+	for _, path := range paths {
+		_, err = os.Stat(path)
+		require.NoError(t, err)
+	}
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	require.Empty(t, lv.Tables(1))
+}
+
+func TestIngestSstFileWriter(t *testing.T) {
+	dir := t.TempDir()
+	lv := NewLevels(3)
+	require.NoError(t, lv.AddTable(userKeyMeta(1, 2, 500, 600, 1), 1))
+
+	// 只有点操作在[0, 10)，范围删除延伸到了L2的key范围
+	path := filepath.Join(t.TempDir(), "ext.sst")
+	w, err := table.NewSstFileWriter(path, table.DefaultOptions())
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, w.Put(x.KeyWithTs([]byte(fmt.Sprintf("key%06d", i)), 0), x.ValueStruct{Value: []byte("v")}))
+	}
+	require.NoError(t, w.DeleteRange([]byte("key000100"), []byte("key000550"), 0))
+	_, err = w.Finish()
+	require.NoError(t, err)
+
+	metas, err := Ingest(lv, dir, []string{path}, table.DefaultOptions(), IngestOptions{Version: 2})
+	require.NoError(t, err)
+	require.Equal(t, 1, metas[0].Level)
+	require.Equal(t, []byte("key000550"), x.ParseUserKey(metas[0].Biggest))
+
+	// 范围删除带有版本时同样拒绝
+	path = filepath.Join(t.TempDir(), "ext2.sst")
+	w, err = table.NewSstFileWriter(path, table.DefaultOptions())
+	require.NoError(t, err)
+	require.NoError(t, w.DeleteRange([]byte("x"), []byte("y"), 3))
+	_, err = w.Finish()
+	require.NoError(t, err)
+	_, err = Ingest(lv, dir, []string{path}, table.DefaultOptions(), IngestOptions{Version: 3})
+	require.ErrorIs(t, err, ErrIngestVersion)
+}
+
+func TestAddTableOverlap(t *testing.T) {
+	lv := NewLevels(2)
+	require.NoError(t, lv.AddTable(userKeyMeta(1, 1, 0, 100, 1), 1))
+	require.ErrorIs(t, lv.AddTable(userKeyMeta(2, 1, 50, 150, 2), 2), ErrTableOverlap)
+	require.Len(t, lv.Tables(1), 1)
+	require.EqualValues(t, 1, lv.MaxVersion())
+
+	// L0中的table可以重叠
+	require.NoError(t, lv.AddTable(userKeyMeta(3, 0, 0, 100, 3), 3))
+	require.NoError(t, lv.AddTable(userKeyMeta(4, 0, 50, 150, 4), 4))
+}
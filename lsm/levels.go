@@ -0,0 +1,131 @@
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/YzmjY/toykv/table"
+	"github.com/YzmjY/toykv/x"
+)
+
+// TableMeta 一个table在LSM中的元数据
+type TableMeta struct {
+	ID    uint64
+	Level int
+	// Smallest、Biggest 带时间戳的内部key
+	Smallest []byte
+	Biggest  []byte
+	Size     uint64
+
+	// GlobalVersion 不为0时，table中所有key的版本都视为这个值，由Ingest分配
+	GlobalVersion uint64
+}
+
+// ErrTableOverlap L0以外的table与同层的table重叠
+var ErrTableOverlap = errors.New("lsm: table overlaps another table in the same level")
+
+// Open 从c中打开这个table，按GlobalVersion读取key的版本。用完后调用DecrRef
+func (m *TableMeta) Open(c *table.TableCache) (table.Reader, error) {
+	return c.Get(m.ID, m.Level, m.GlobalVersion)
+}
+
+// overlaps userKey的范围是否与[smallest, biggest]重叠。
+// 同一个userKey的不同版本必须按新旧分布在不同的层，所以只比较userKey
+func (m *TableMeta) overlaps(smallest, biggest []byte) bool {
+	return bytes.Compare(x.ParseUserKey(m.Smallest), x.ParseUserKey(biggest)) <= 0 &&
+		bytes.Compare(x.ParseUserKey(smallest), x.ParseUserKey(m.Biggest)) <= 0
+}
+
+// Levels 各层table的元数据。L0的table之间可能重叠，按加入的顺序排列，越新的越靠后；
+// 其他层的table互不重叠，按smallest排序
+type Levels struct {
+	mu         sync.RWMutex
+	levels     [][]*TableMeta
+	nextID     uint64
+	maxVersion uint64
+}
+
+func NewLevels(numLevels int) *Levels {
+	x.AssertTrue(numLevels > 0)
+	return &Levels{
+		levels: make([][]*TableMeta, numLevels),
+		nextID: 1,
+	}
+}
+
+func (lv *Levels) NumLevels() int {
+	return len(lv.levels)
+}
+
+// Tables level上所有table的元数据
+func (lv *Levels) Tables(level int) []*TableMeta {
+	lv.mu.RLock()
+	defer lv.mu.RUnlock()
+	return append([]*TableMeta(nil), lv.levels[level]...)
+}
+
+// MaxVersion 所有table中最大的版本
+func (lv *Levels) MaxVersion() uint64 {
+	lv.mu.RLock()
+	defer lv.mu.RUnlock()
+	return lv.maxVersion
+}
+
+// reserveIDs 预留n个连续的table id，返回第一个
+func (lv *Levels) reserveIDs(n int) uint64 {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+	id := lv.nextID
+	lv.nextID += uint64(n)
+	return id
+}
+
+// AddTable 添加一个table，maxVersion为table中最大的版本。L0以外的table不能与同层的table重叠
+func (lv *Levels) AddTable(meta *TableMeta, maxVersion uint64) error {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+
+	if meta.Level > 0 && lv.overlapsLocked(meta.Level, meta.Smallest, meta.Biggest) {
+		return fmt.Errorf("%w: table %d in L%d", ErrTableOverlap, meta.ID, meta.Level)
+	}
+	lv.addTableLocked(meta, maxVersion)
+	return nil
+}
+
+func (lv *Levels) addTableLocked(meta *TableMeta, maxVersion uint64) {
+	x.AssertTrue(meta.Level == 0 || !lv.overlapsLocked(meta.Level, meta.Smallest, meta.Biggest))
+
+	tables := append(lv.levels[meta.Level], meta)
+	if meta.Level > 0 {
+		sort.Slice(tables, func(i, j int) bool {
+			return x.KeysCompare(tables[i].Smallest, tables[j].Smallest) < 0
+		})
+	}
+	lv.levels[meta.Level] = tables
+
+	if meta.ID >= lv.nextID {
+		lv.nextID = meta.ID + 1
+	}
+	if maxVersion > lv.maxVersion {
+		lv.maxVersion = maxVersion
+	}
+}
+
+func (lv *Levels) overlapsLocked(level int, smallest, biggest []byte) bool {
+	for _, t := range lv.levels[level] {
+		if t.overlaps(smallest, biggest) {
+			return true
+		}
+	}
+	return false
+}
+
+// Overlaps level上是否有table与[smallest, biggest]重叠
+func (lv *Levels) Overlaps(level int, smallest, biggest []byte) bool {
+	lv.mu.RLock()
+	defer lv.mu.RUnlock()
+	return lv.overlapsLocked(level, smallest, biggest)
+}
@@ -1,6 +1,7 @@
 package skiplist
 
 import (
+	"fmt"
 	"sync/atomic"
 	"unsafe"
 
@@ -70,7 +71,10 @@ func (s *Arena) getKey(offset uint32, size uint16) []byte {
 }
 
 func (s *Arena) getVal(offset uint32, size uint32) (ret x.ValueStruct) {
-	ret.Decode(s.buf[offset : offset+size])
+	// 内存中的数据被破坏，无法恢复，panic让调用方看到损坏的位置
+	if err := ret.DecodeChecked(s.buf[offset : offset+size]); err != nil {
+		panic(fmt.Sprintf("skiplist: corrupted value at arena offset %d: %v", offset, err))
+	}
 	return
 }
 
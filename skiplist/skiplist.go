@@ -134,6 +134,7 @@ func (s *Skiplist) getHeight() int32 {
 }
 
 // !!! 无锁实现
+// Put v.Meta设置了x.BitChecksum时value带着checksum写入arena，读取时校验
 func (s *Skiplist) Put(key []byte, v x.ValueStruct) {
 	// 实现无锁的插入
 	height := s.getHeight()
@@ -1,2 +1,441 @@
 package table
 
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/YzmjY/toykv/x"
+)
+
+// block的格式：
+//
+//	| entry 0 | entry 1 | ... | entry n-1 | restart 0 | ... | restart m-1 | numRestarts |
+//
+// entry：key与前一个key共享前缀，只保存不同的部分
+//
+//	| shared(uvarint) | unshared(uvarint) | valueLen(uvarint) | key[shared:] | value |
+//
+// 每restartInterval个entry设置一个重启点，重启点上的entry保存完整的key(shared == 0)，
+// restart为该entry在block中的偏移(uint32)，numRestarts(uint32)为重启点个数。
+// data block中value为x.ValueStruct.Encode的结果。
+// numRestarts的最高位为1时，重启点数组之后还有hash index，见block_hash_index.go
+
+const (
+	defaultRestartInterval = 16
+
+	sizeUint32 = 4
+)
+
+var errBadBlock = errors.New("table: bad block")
+
+type blockBuilder struct {
+	restartInterval int
+
+	buf      []byte
+	restarts []uint32
+	counter  int // 距离上一个重启点的entry数
+	nEntries int
+	lastKey  []byte
+
+	// hashIndex 是否生成hash index，只用于data block
+	hashIndex bool
+	hashes    []hashIndexEntry
+}
+
+func newBlockBuilder(restartInterval int) *blockBuilder {
+	if restartInterval <= 0 {
+		restartInterval = defaultRestartInterval
+	}
+
+	return &blockBuilder{
+		restartInterval: restartInterval,
+		restarts:        []uint32{0},
+	}
+}
+
+// add 添加一个entry，key需要递增
+func (b *blockBuilder) add(key, value []byte) {
+	shared := 0
+	if b.counter < b.restartInterval {
+		n := len(b.lastKey)
+		if len(key) < n {
+			n = len(key)
+		}
+		for shared < n && b.lastKey[shared] == key[shared] {
+			shared++
+		}
+	} else {
+		b.restarts = append(b.restarts, uint32(len(b.buf)))
+		b.counter = 0
+	}
+	if b.hashIndex {
+		b.addHash(key)
+	}
+
+	b.buf = binary.AppendUvarint(b.buf, uint64(shared))
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(key)-shared))
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(value)))
+	b.buf = append(b.buf, key[shared:]...)
+	b.buf = append(b.buf, value...)
+
+	b.lastKey = append(b.lastKey[:0], key...)
+	b.counter++
+	b.nEntries++
+}
+
+// addEntry 向data block中添加一个kv
+func (b *blockBuilder) addEntry(key []byte, v x.ValueStruct) {
+	vs := make([]byte, v.EncodeSize())
+	v.Encode(vs)
+	b.add(key, vs)
+}
+
+func (b *blockBuilder) empty() bool {
+	return b.nEntries == 0
+}
+
+// estimatedSize finish之后block的大小
+func (b *blockBuilder) estimatedSize() int {
+	return len(b.buf) + len(b.restarts)*sizeUint32 + sizeUint32 + b.hashIndexSize()
+}
+
+// finish 追加重启点数组，返回完整的block。返回值在reset之前有效
+func (b *blockBuilder) finish() []byte {
+	for _, r := range b.restarts {
+		b.buf = binary.LittleEndian.AppendUint32(b.buf, r)
+	}
+	numRestarts := uint32(len(b.restarts))
+	if b.canUseHashIndex() {
+		b.buf = b.appendHashIndex(b.buf)
+		numRestarts |= blockHashIndexFlag
+	}
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, numRestarts)
+	return b.buf
+}
+
+func (b *blockBuilder) reset() {
+	b.buf = b.buf[:0]
+	b.restarts = append(b.restarts[:0], 0)
+	b.counter = 0
+	b.nEntries = 0
+	b.lastKey = b.lastKey[:0]
+	b.hashes = b.hashes[:0]
+}
+
+type block struct {
+	raw           []byte // 包括重启点数组在内的完整block
+	data          []byte // entry部分
+	restartOffset int
+	numRestarts   int
+	// hashBuckets hash index的bucket数组，没有hash index时为nil
+	hashBuckets []byte
+
+	// checkValues entry的value是编码后的x.ValueStruct，解析时校验key中的操作类型，
+	// 迭代器停下时用DecodeChecked校验当前的value。
+	// 只有data block需要，index block中的value是block handle
+	checkValues bool
+
+	// minKeyLen key的最小长度，data和index block中的key都是带时间戳的内部key，
+	// 长度不足说明block已经损坏，不能交给x.ParseTs等函数
+	minKeyLen int
+}
+
+func newBlock(data []byte) (*block, error) {
+	if len(data) < sizeUint32 {
+		return nil, errBadBlock
+	}
+
+	packed := binary.LittleEndian.Uint32(data[len(data)-sizeUint32:])
+	end := len(data) - sizeUint32
+
+	var buckets []byte
+	if packed&blockHashIndexFlag != 0 {
+		var ok bool
+		if buckets, ok = parseHashIndex(data[:end]); !ok {
+			return nil, errBadBlock
+		}
+		end -= len(buckets) + sizeUint16
+	}
+
+	numRestarts := int(packed &^ blockHashIndexFlag)
+	if numRestarts == 0 || numRestarts > end/sizeUint32 {
+		return nil, errBadBlock
+	}
+
+	restartOffset := end - numRestarts*sizeUint32
+	return &block{
+		raw:           data,
+		data:          data[:restartOffset],
+		restartOffset: restartOffset,
+		numRestarts:   numRestarts,
+		hashBuckets:   buckets,
+		minKeyLen:     8,
+	}, nil
+}
+
+func (b *block) restartPoint(idx int) int {
+	off := b.restartOffset + idx*sizeUint32
+	return int(binary.LittleEndian.Uint32(b.raw[off:]))
+}
+
+// blockIterator 在一个block内迭代
+type blockIterator struct {
+	b *block
+
+	offset     int // 当前entry的偏移，等于len(b.data)表示越过了最后一个entry
+	nextOffset int // 下一个entry的偏移
+	restartIdx int // 当前entry所在的重启区间
+	key        []byte
+	val        []byte
+	// value checkValues时当前entry解码后的value
+	value x.ValueStruct
+
+	err error
+}
+
+func (b *block) newIterator() *blockIterator {
+	return &blockIterator{
+		b:          b,
+		offset:     len(b.data),
+		nextOffset: len(b.data),
+	}
+}
+
+func newBlockIterator(raw []byte) (*blockIterator, error) {
+	b, err := newBlock(raw)
+	if err != nil {
+		return nil, err
+	}
+	return b.newIterator(), nil
+}
+
+func newDataBlockIterator(raw []byte) (*blockIterator, error) {
+	b, err := newBlock(raw)
+	if err != nil {
+		return nil, err
+	}
+	b.checkValues = true
+	return b.newIterator(), nil
+}
+
+func (it *blockIterator) Error() error {
+	return it.err
+}
+
+func (it *blockIterator) Vaild() bool {
+	return it.err == nil && it.offset < len(it.b.data)
+}
+
+func (it *blockIterator) Key() []byte {
+	return it.key
+}
+
+// RawValue 未解码的value
+func (it *blockIterator) RawValue() []byte {
+	return it.val
+}
+
+// Value 用于value为x.ValueStruct的block，newDataBlockIterator创建的迭代器
+// 返回停下时已经校验并解码的value，其余情况按可信的数据直接解码
+func (it *blockIterator) Value() (ret x.ValueStruct) {
+	if it.b.checkValues {
+		return it.value
+	}
+	ret.Decode(it.val)
+	return
+}
+
+// decodeValue 迭代器停下时解码并校验当前entry的value，Seek和Prev经过的entry不解码
+func (it *blockIterator) decodeValue() {
+	if !it.b.checkValues || !it.Vaild() {
+		return
+	}
+	if err := it.value.DecodeChecked(it.val); err != nil {
+		it.err = err
+		it.invalidate()
+	}
+}
+
+func (it *blockIterator) invalidate() {
+	it.offset = len(it.b.data)
+	it.nextOffset = len(it.b.data)
+}
+
+func (it *blockIterator) corrupted() {
+	it.err = errBadBlock
+	it.invalidate()
+}
+
+// seekToRestartPoint 定位到重启点之前，调用parseNext后位于重启点上的entry
+func (it *blockIterator) seekToRestartPoint(idx int) {
+	it.key = it.key[:0]
+	it.restartIdx = idx
+	it.nextOffset = it.b.restartPoint(idx)
+}
+
+// parseNext 解析nextOffset处的entry
+func (it *blockIterator) parseNext() bool {
+	it.offset = it.nextOffset
+	data := it.b.data
+	if it.offset >= len(data) {
+		it.invalidate()
+		return false
+	}
+
+	p := data[it.offset:]
+	shared, n1 := binary.Uvarint(p)
+	if n1 <= 0 {
+		it.corrupted()
+		return false
+	}
+	unshared, n2 := binary.Uvarint(p[n1:])
+	if n2 <= 0 {
+		it.corrupted()
+		return false
+	}
+	valueLen, n3 := binary.Uvarint(p[n1+n2:])
+	if n3 <= 0 {
+		it.corrupted()
+		return false
+	}
+	p = p[n1+n2+n3:]
+	if shared > uint64(len(it.key)) || uint64(len(p)) < unshared || uint64(len(p))-unshared < valueLen {
+		it.corrupted()
+		return false
+	}
+
+	it.key = append(it.key[:shared], p[:unshared]...)
+	if len(it.key) < it.b.minKeyLen {
+		it.corrupted()
+		return false
+	}
+	it.val = p[unshared : unshared+valueLen]
+	if it.b.checkValues {
+		if _, err := x.ParseInternalKey(it.key); err != nil {
+			it.err = err
+			it.invalidate()
+			return false
+		}
+	}
+	it.nextOffset = it.offset + n1 + n2 + n3 + int(unshared+valueLen)
+
+	for it.restartIdx+1 < it.b.numRestarts && it.b.restartPoint(it.restartIdx+1) <= it.offset {
+		it.restartIdx++
+	}
+	return true
+}
+
+func (it *blockIterator) SeekToFirst() {
+	if it.err != nil {
+		return
+	}
+	it.seekToRestartPoint(0)
+	it.parseNext()
+	it.decodeValue()
+}
+
+func (it *blockIterator) SeekToLast() {
+	if it.err != nil {
+		return
+	}
+	it.seekToRestartPoint(it.b.numRestarts - 1)
+	for it.parseNext() && it.nextOffset < len(it.b.data) {
+	}
+	it.decodeValue()
+}
+
+// Seek 移动到第一个大于等于key的位置
+func (it *blockIterator) Seek(key []byte) {
+	if it.err != nil {
+		return
+	}
+	if len(it.b.data) == 0 {
+		it.invalidate()
+		return
+	}
+
+	// 找到最后一个key小于目标key的重启点
+	var parseErr bool
+	idx := sort.Search(it.b.numRestarts, func(i int) bool {
+		k, ok := it.restartKey(i)
+		if !ok {
+			parseErr = true
+			return true
+		}
+		return x.KeysCompare(k, key) >= 0
+	})
+	if parseErr {
+		it.corrupted()
+		return
+	}
+	if idx > 0 {
+		idx--
+	}
+
+	it.seekToRestartPoint(idx)
+	for it.parseNext() {
+		if x.KeysCompare(it.key, key) >= 0 {
+			break
+		}
+	}
+	it.decodeValue()
+}
+
+// restartKey 重启点上entry的完整key
+func (it *blockIterator) restartKey(idx int) ([]byte, bool) {
+	off := it.b.restartPoint(idx)
+	if off >= len(it.b.data) {
+		return nil, false
+	}
+
+	p := it.b.data[off:]
+	shared, n1 := binary.Uvarint(p)
+	if n1 <= 0 || shared != 0 {
+		return nil, false
+	}
+	unshared, n2 := binary.Uvarint(p[n1:])
+	if n2 <= 0 {
+		return nil, false
+	}
+	_, n3 := binary.Uvarint(p[n1+n2:])
+	if n3 <= 0 {
+		return nil, false
+	}
+	p = p[n1+n2+n3:]
+	if uint64(len(p)) < unshared || unshared < uint64(it.b.minKeyLen) {
+		return nil, false
+	}
+	return p[:unshared], true
+}
+
+func (it *blockIterator) Next() {
+	if !it.Vaild() {
+		return
+	}
+	it.parseNext()
+	it.decodeValue()
+}
+
+// Prev 前缀压缩的entry无法反向解析，从所在区间（或前一个区间）的重启点开始向后扫描
+func (it *blockIterator) Prev() {
+	if !it.Vaild() {
+		return
+	}
+
+	cur := it.offset
+	idx := it.restartIdx
+	for it.b.restartPoint(idx) >= cur {
+		if idx == 0 {
+			// 已经是第一个entry
+			it.invalidate()
+			return
+		}
+		idx--
+	}
+
+	it.seekToRestartPoint(idx)
+	for it.parseNext() && it.nextOffset < cur {
+	}
+	it.decodeValue()
+}
@@ -0,0 +1,195 @@
+package table
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	cacheShardBits = 4
+	cacheShards    = 1 << cacheShardBits
+
+	// 每个entry除数据外的额外开销
+	cacheEntryOverhead = 64
+)
+
+// cacheKind 缓存中block的分类，分别统计
+type cacheKind int
+
+const (
+	cacheKindData cacheKind = iota
+	cacheKindIndex
+	cacheKindFilter
+	numCacheKinds
+)
+
+func cacheKindOf(typ BlockType) cacheKind {
+	switch typ {
+	case BlockTypeIndex, BlockTypeIndexPartition:
+		return cacheKindIndex
+	case BlockTypeFilter, BlockTypeFilterIndex, BlockTypeFilterPartition:
+		return cacheKindFilter
+	default:
+		return cacheKindData
+	}
+}
+
+type cacheKey struct {
+	tableID uint64
+	offset  uint64
+}
+
+type cacheEntry struct {
+	key    cacheKey
+	kind   cacheKind
+	value  []byte
+	charge int64
+	pinned bool
+}
+
+// cacheShard 一个LRU分片，pinned的entry不在链表中，不会被淘汰
+type cacheShard struct {
+	mu       sync.Mutex
+	capacity int64
+	usage    int64
+	lru      list.List // 表头为最近使用的
+	entries  map[cacheKey]*list.Element
+}
+
+// BlockCache 所有table共享的block缓存，按(table, block offset)索引，
+// 缓存的是校验和解压之后的block
+type BlockCache struct {
+	shards [cacheShards]cacheShard
+
+	hits   [numCacheKinds]atomic.Uint64
+	misses [numCacheKinds]atomic.Uint64
+	usage  [numCacheKinds]atomic.Int64
+}
+
+// NewBlockCache capacity为缓存占用内存的上限（字节）
+func NewBlockCache(capacity int64) *BlockCache {
+	c := &BlockCache{}
+	for i := range c.shards {
+		c.shards[i].capacity = capacity / cacheShards
+		c.shards[i].entries = make(map[cacheKey]*list.Element)
+	}
+	return c
+}
+
+func (c *BlockCache) shard(key cacheKey) *cacheShard {
+	h := key.tableID*0x9e3779b97f4a7c15 ^ key.offset*0xc2b2ae3d27d4eb4f
+	return &c.shards[h>>(64-cacheShardBits)]
+}
+
+func (c *BlockCache) get(tableID, offset uint64, typ BlockType) ([]byte, bool) {
+	key := cacheKey{tableID: tableID, offset: offset}
+	kind := cacheKindOf(typ)
+	s := c.shard(key)
+
+	s.mu.Lock()
+	elem, ok := s.entries[key]
+	if ok {
+		e := elem.Value.(*cacheEntry)
+		if !e.pinned {
+			s.lru.MoveToFront(elem)
+		}
+		s.mu.Unlock()
+		c.hits[kind].Add(1)
+		return e.value, true
+	}
+	s.mu.Unlock()
+
+	c.misses[kind].Add(1)
+	return nil, false
+}
+
+// set 插入一个block，pinned为true时直到remove之前都不会被淘汰
+func (c *BlockCache) set(tableID, offset uint64, typ BlockType, value []byte, pinned bool) {
+	key := cacheKey{tableID: tableID, offset: offset}
+	e := &cacheEntry{
+		key:    key,
+		kind:   cacheKindOf(typ),
+		value:  value,
+		charge: int64(len(value)) + cacheEntryOverhead,
+		pinned: pinned,
+	}
+	s := c.shard(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, ok := s.entries[key]; ok {
+		c.removeLocked(s, old)
+	}
+
+	var elem *list.Element
+	if pinned {
+		elem = &list.Element{Value: e}
+	} else {
+		elem = s.lru.PushFront(e)
+	}
+	s.entries[key] = elem
+	s.usage += e.charge
+	c.usage[e.kind].Add(e.charge)
+
+	for s.usage > s.capacity {
+		back := s.lru.Back()
+		if back == nil {
+			// 剩下的都是pinned的entry
+			break
+		}
+		c.removeLocked(s, back)
+	}
+}
+
+func (c *BlockCache) remove(tableID, offset uint64) {
+	key := cacheKey{tableID: tableID, offset: offset}
+	s := c.shard(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.entries[key]; ok {
+		c.removeLocked(s, elem)
+	}
+}
+
+func (c *BlockCache) removeLocked(s *cacheShard, elem *list.Element) {
+	e := elem.Value.(*cacheEntry)
+	if !e.pinned {
+		s.lru.Remove(elem)
+	}
+	delete(s.entries, e.key)
+	s.usage -= e.charge
+	c.usage[e.kind].Add(-e.charge)
+}
+
+// CacheKindStats 一类block的缓存统计
+type CacheKindStats struct {
+	Hits   uint64
+	Misses uint64
+	Usage  int64 // 占用的字节数
+}
+
+// CacheStats 分别统计data、index、filter block
+type CacheStats struct {
+	Data   CacheKindStats
+	Index  CacheKindStats
+	Filter CacheKindStats
+}
+
+func (c *BlockCache) kindStats(kind cacheKind) CacheKindStats {
+	return CacheKindStats{
+		Hits:   c.hits[kind].Load(),
+		Misses: c.misses[kind].Load(),
+		Usage:  c.usage[kind].Load(),
+	}
+}
+
+func (c *BlockCache) Stats() CacheStats {
+	return CacheStats{
+		Data:   c.kindStats(cacheKindData),
+		Index:  c.kindStats(cacheKindIndex),
+		Filter: c.kindStats(cacheKindFilter),
+	}
+}
@@ -0,0 +1,146 @@
+package table
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockCacheEviction(t *testing.T) {
+	const blockSize = 1000
+	// 每个分片能放下两个block
+	c := NewBlockCache(cacheShards * 2 * (blockSize + cacheEntryOverhead))
+
+	n := uint64(cacheShards * 8)
+	for i := uint64(0); i < n; i++ {
+		c.set(1, i, BlockTypeData, make([]byte, blockSize), false)
+	}
+	stats := c.Stats()
+	require.LessOrEqual(t, stats.Data.Usage, int64(cacheShards*2*(blockSize+cacheEntryOverhead)))
+	require.Greater(t, stats.Data.Usage, int64(0))
+
+	cached := 0
+	for i := uint64(0); i < n; i++ {
+		if _, ok := c.get(1, i, BlockTypeData); ok {
+			cached++
+		}
+	}
+	require.Less(t, cached, int(n))
+	stats = c.Stats()
+	require.EqualValues(t, cached, stats.Data.Hits)
+	require.EqualValues(t, int(n)-cached, stats.Data.Misses)
+}
+
+func TestBlockCacheLRU(t *testing.T) {
+	c := NewBlockCache(cacheShards * 2 * (100 + cacheEntryOverhead))
+	key := cacheKey{tableID: 1, offset: 0}
+	s := c.shard(key)
+
+	// 找出落在同一个分片的另外两个offset
+	var others []uint64
+	for off := uint64(1); len(others) < 2; off++ {
+		if c.shard(cacheKey{tableID: 1, offset: off}) == s {
+			others = append(others, off)
+		}
+	}
+
+	c.set(1, 0, BlockTypeData, make([]byte, 100), false)
+	c.set(1, others[0], BlockTypeData, make([]byte, 100), false)
+	// 访问后0变为最近使用的，插入新的block时淘汰others[0]
+	_, ok := c.get(1, 0, BlockTypeData)
+	require.True(t, ok)
+	c.set(1, others[1], BlockTypeData, make([]byte, 100), false)
+
+	_, ok = c.get(1, 0, BlockTypeData)
+	require.True(t, ok)
+	_, ok = c.get(1, others[0], BlockTypeData)
+	require.False(t, ok)
+}
+
+func TestBlockCachePinned(t *testing.T) {
+	c := NewBlockCache(cacheShards * 1000)
+	c.set(1, 0, BlockTypeIndex, make([]byte, 5000), true)
+	c.set(1, 1, BlockTypeFilter, make([]byte, 100), false)
+
+	_, ok := c.get(1, 0, BlockTypeIndex)
+	require.True(t, ok)
+	stats := c.Stats()
+	require.EqualValues(t, 5000+cacheEntryOverhead, stats.Index.Usage)
+	require.EqualValues(t, 1, stats.Index.Hits)
+
+	c.remove(1, 0)
+	_, ok = c.get(1, 0, BlockTypeIndex)
+	require.False(t, ok)
+	require.Zero(t, c.Stats().Index.Usage)
+}
+
+func TestTableBlockCache(t *testing.T) {
+	const n = 2000
+	opts := DefaultOptions()
+	opts.BlockSize = 512
+	path := buildTestTable(t, n, opts)
+
+	for _, mode := range []LoadingMode{LoadingModeMmap, LoadingModePread} {
+		t.Run(mode.String(), func(t *testing.T) {
+			opts.LoadingMode = mode
+			opts.BlockCache = NewBlockCache(1 << 20)
+			tbl, err := Open(path, opts)
+			require.NoError(t, err)
+			require.Nil(t, tbl.index)
+			require.Nil(t, tbl.filter)
+
+			for round := 0; round < 2; round++ {
+				for i := 0; i < n; i++ {
+					v, err := tbl.Get(tableKey(i))
+					require.NoError(t, err)
+					require.Equal(t, tableValue(i).Value, v.Value)
+				}
+			}
+			stats := opts.BlockCache.Stats()
+			require.Greater(t, stats.Data.Hits, stats.Data.Misses)
+			require.Greater(t, stats.Index.Hits, uint64(n))
+			require.Greater(t, stats.Filter.Hits, uint64(n))
+			require.Greater(t, stats.Data.Usage, int64(0))
+
+			iter := tbl.NewIterator(false)
+			cnt := 0
+			for iter.Rewind(); iter.Vaild(); iter.Next() {
+				cnt++
+			}
+			require.NoError(t, iter.Error())
+			require.Equal(t, n, cnt)
+			iter.Close()
+			require.NoError(t, tbl.Close())
+		})
+	}
+}
+
+func TestTableBlockCachePinL0(t *testing.T) {
+	opts := DefaultOptions()
+	path := buildTestTable(t, 1000, opts)
+
+	opts.BlockCache = NewBlockCache(1 << 20)
+	opts.PinL0FilterAndIndexBlocks = true
+	opts.Level = 0
+	tbl, err := Open(path, opts)
+	require.NoError(t, err)
+	require.NotNil(t, tbl.index)
+	require.NotNil(t, tbl.filter)
+
+	stats := opts.BlockCache.Stats()
+	require.Greater(t, stats.Index.Usage, int64(0))
+	require.Greater(t, stats.Filter.Usage, int64(0))
+
+	// 关闭后释放pin住的block
+	require.NoError(t, tbl.Close())
+	stats = opts.BlockCache.Stats()
+	require.Zero(t, stats.Index.Usage)
+	require.Zero(t, stats.Filter.Usage)
+
+	// 其他level不pin
+	opts.Level = 1
+	tbl, err = Open(path, opts)
+	require.NoError(t, err)
+	defer tbl.Close()
+	require.Nil(t, tbl.index)
+}
@@ -0,0 +1,139 @@
+package table
+
+import (
+	"encoding/binary"
+
+	"github.com/YzmjY/toykv/bloomfilter"
+	"github.com/YzmjY/toykv/x"
+)
+
+// data block的hash index，与RocksDB的data block hash index相同，
+// 把userKey的hash映射到它第一次出现的重启区间，点查时不需要在重启点上二分查找：
+//
+//	| entries | restarts | bucket 0 | ... | bucket n-1 | numBuckets(uint16) | numRestarts|flag(uint32) |
+//
+// 每个bucket一个字节，为重启区间的下标，或者为hashBucketEmpty、hashBucketCollision。
+// 发生冲突的bucket退化为二分查找。重启点超过maxHashIndexRestarts的block不生成hash index
+
+const (
+	blockHashIndexFlag uint32 = 1 << 31
+
+	hashBucketEmpty     = 0xfe
+	hashBucketCollision = 0xff
+	// bucket中能表示的重启区间个数
+	maxHashIndexRestarts = hashBucketEmpty
+
+	// 每个bucket平均对应的key个数
+	hashIndexUtilRatio = 0.75
+
+	sizeUint16 = 2
+)
+
+type hashIndexEntry struct {
+	hash       uint32
+	restartIdx uint8
+}
+
+// addHash 记录key的userKey第一次出现的重启区间
+func (b *blockBuilder) addHash(key []byte) {
+	// 在add更新lastKey之前调用，lastKey为上一个key
+	if b.nEntries > 0 && x.SameUserKey(b.lastKey, key) {
+		return
+	}
+	restartIdx := len(b.restarts) - 1
+	if restartIdx >= maxHashIndexRestarts {
+		return
+	}
+	b.hashes = append(b.hashes, hashIndexEntry{
+		hash:       bloomfilter.Hash(x.ParseUserKey(key)),
+		restartIdx: uint8(restartIdx),
+	})
+}
+
+func (b *blockBuilder) canUseHashIndex() bool {
+	return b.hashIndex && b.nEntries > 0 && len(b.restarts) <= maxHashIndexRestarts
+}
+
+func (b *blockBuilder) numHashBuckets() int {
+	n := int(float64(len(b.hashes))/hashIndexUtilRatio) + 1
+	if n > 0xffff {
+		n = 0xffff
+	}
+	return n
+}
+
+func (b *blockBuilder) hashIndexSize() int {
+	if !b.canUseHashIndex() {
+		return 0
+	}
+	return b.numHashBuckets() + sizeUint16
+}
+
+func (b *blockBuilder) appendHashIndex(dst []byte) []byte {
+	n := b.numHashBuckets()
+	start := len(dst)
+	for i := 0; i < n; i++ {
+		dst = append(dst, hashBucketEmpty)
+	}
+	buckets := dst[start:]
+	for _, e := range b.hashes {
+		bkt := &buckets[e.hash%uint32(n)]
+		switch *bkt {
+		case hashBucketEmpty:
+			*bkt = e.restartIdx
+		case e.restartIdx, hashBucketCollision:
+		default:
+			*bkt = hashBucketCollision
+		}
+	}
+	return binary.LittleEndian.AppendUint16(dst, uint16(n))
+}
+
+// parseHashIndex 从data末尾（去掉numRestarts之后）解析出bucket数组
+func parseHashIndex(data []byte) ([]byte, bool) {
+	if len(data) < sizeUint16 {
+		return nil, false
+	}
+	n := int(binary.LittleEndian.Uint16(data[len(data)-sizeUint16:]))
+	if n == 0 || n > len(data)-sizeUint16 {
+		return nil, false
+	}
+	end := len(data) - sizeUint16
+	return data[end-n : end], true
+}
+
+// seekForGet 点查时使用，返回false表示block中一定没有key的userKey，此时迭代器无效。
+// 否则与Seek相同，但只保证结果与key的userKey相同时是正确的。
+// 没有hash index或者bucket冲突时退化为Seek
+func (it *blockIterator) seekForGet(key []byte) bool {
+	if it.err != nil {
+		return false
+	}
+	buckets := it.b.hashBuckets
+	if buckets == nil {
+		it.Seek(key)
+		return true
+	}
+
+	bkt := buckets[bloomfilter.Hash(x.ParseUserKey(key))%uint32(len(buckets))]
+	switch {
+	case bkt == hashBucketEmpty:
+		it.invalidate()
+		return false
+	case bkt == hashBucketCollision:
+		it.Seek(key)
+		return true
+	case int(bkt) >= it.b.numRestarts:
+		it.corrupted()
+		return false
+	}
+
+	it.seekToRestartPoint(int(bkt))
+	for it.parseNext() {
+		if x.KeysCompare(it.key, key) >= 0 {
+			break
+		}
+	}
+	it.decodeValue()
+	return true
+}
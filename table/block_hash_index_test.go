@@ -0,0 +1,109 @@
+package table
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/YzmjY/toykv/x"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockHashIndex(t *testing.T) {
+	const n = 300
+	b := newBlockBuilder(4)
+	b.hashIndex = true
+	// 每个userKey有3个版本，版本会跨越重启区间
+	for i := 0; i < n; i++ {
+		for ts := 3; ts >= 1; ts-- {
+			b.addEntry(x.KeyWithTs([]byte(fmt.Sprintf("key%05d", i*2)), uint64(ts)), x.ValueStruct{Value: []byte(fmt.Sprint(i, ts))})
+		}
+	}
+	size := b.estimatedSize()
+	raw := b.finish()
+	require.Equal(t, size, len(raw))
+
+	blk, err := newBlock(raw)
+	require.NoError(t, err)
+	require.NotNil(t, blk.hashBuckets)
+	it := blk.newIterator()
+
+	for i := 0; i < n; i++ {
+		for ts := 0; ts <= 4; ts++ {
+			key := x.KeyWithTs([]byte(fmt.Sprintf("key%05d", i*2)), uint64(ts))
+			require.True(t, it.seekForGet(key))
+			if ts == 0 {
+				// 没有这么小的版本
+				require.True(t, !it.Vaild() || !x.SameUserKey(it.Key(), key))
+				continue
+			}
+			require.True(t, it.Vaild())
+			want := ts
+			if want > 3 {
+				want = 3
+			}
+			require.Equal(t, x.KeyWithTs([]byte(fmt.Sprintf("key%05d", i*2)), uint64(want)), it.Key())
+		}
+	}
+
+	// 不存在的key
+	missed := 0
+	for i := 0; i < n; i++ {
+		key := x.KeyWithTs([]byte(fmt.Sprintf("key%05d", i*2+1)), 3)
+		if !it.seekForGet(key) {
+			missed++
+			require.False(t, it.Vaild())
+			continue
+		}
+		require.True(t, !it.Vaild() || !x.SameUserKey(it.Key(), key))
+	}
+	require.Greater(t, missed, n/3)
+	require.NoError(t, it.Error())
+
+	// 其他操作不受hash index影响
+	it.SeekToLast()
+	require.Equal(t, x.KeyWithTs([]byte(fmt.Sprintf("key%05d", n*2-2)), 1), it.Key())
+}
+
+func TestBlockHashIndexTooManyRestarts(t *testing.T) {
+	b := newBlockBuilder(1)
+	b.hashIndex = true
+	for i := 0; i < maxHashIndexRestarts+1; i++ {
+		b.addEntry(blockKey(i), x.ValueStruct{})
+	}
+	size := b.estimatedSize()
+	raw := b.finish()
+	require.Equal(t, size, len(raw))
+
+	blk, err := newBlock(raw)
+	require.NoError(t, err)
+	require.Nil(t, blk.hashBuckets)
+	it := blk.newIterator()
+	require.True(t, it.seekForGet(blockKey(100)))
+	require.Equal(t, blockKey(100), it.Key())
+}
+
+func TestTableDataBlockHashIndex(t *testing.T) {
+	const n = 5000
+	opts := DefaultOptions()
+	opts.DataBlockHashIndex = true
+	tbl, err := Open(buildTestTable(t, n, opts), opts)
+	require.NoError(t, err)
+	defer tbl.Close()
+
+	for i := 0; i < n; i++ {
+		v, err := tbl.Get(x.KeyWithTs([]byte(fmt.Sprintf("key%06d", i)), 10))
+		require.NoError(t, err)
+		require.Equal(t, tableValue(i).Value, v.Value)
+	}
+	v, err := tbl.Get(x.KeyWithTs([]byte("key000006"), 1))
+	require.NoError(t, err)
+	require.Nil(t, v.Value)
+
+	it := tbl.NewIterator(false)
+	defer it.Close()
+	cnt := 0
+	for it.Rewind(); it.Vaild(); it.Next() {
+		cnt++
+	}
+	require.Equal(t, n, cnt)
+}
@@ -0,0 +1,99 @@
+package table
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/YzmjY/toykv/x"
+	"github.com/stretchr/testify/require"
+)
+
+func blockKey(i int) []byte {
+	return x.KeyWithTs([]byte(fmt.Sprintf("key%05d", i)), uint64(i))
+}
+
+func buildBlock(t *testing.T, n, restartInterval int) []byte {
+	b := newBlockBuilder(restartInterval)
+	for i := 0; i < n; i++ {
+		b.addEntry(blockKey(i*2), x.ValueStruct{Meta: byte(i), ExpiresAt: uint64(i), Value: []byte(fmt.Sprintf("val%d", i))})
+	}
+	size := b.estimatedSize()
+	raw := b.finish()
+	require.Equal(t, size, len(raw))
+	return raw
+}
+
+func TestBlockIterator(t *testing.T) {
+	for _, restartInterval := range []int{1, 3, 16} {
+		const n = 100
+		it, err := newBlockIterator(buildBlock(t, n, restartInterval))
+		require.NoError(t, err)
+
+		it.SeekToFirst()
+		for i := 0; i < n; i++ {
+			require.True(t, it.Vaild())
+			require.Equal(t, blockKey(i*2), it.Key())
+			v := it.Value()
+			require.Equal(t, fmt.Sprintf("val%d", i), string(v.Value))
+			require.EqualValues(t, i, v.ExpiresAt)
+			it.Next()
+		}
+		require.False(t, it.Vaild())
+
+		it.SeekToLast()
+		for i := n - 1; i >= 0; i-- {
+			require.True(t, it.Vaild())
+			require.Equal(t, blockKey(i*2), it.Key())
+			it.Prev()
+		}
+		require.False(t, it.Vaild())
+
+		for i := 0; i < n*2-1; i++ {
+			it.Seek(blockKey(i))
+			require.True(t, it.Vaild())
+			require.Equal(t, blockKey((i+1)/2*2), it.Key())
+		}
+		it.Seek(blockKey(n * 2))
+		require.False(t, it.Vaild())
+		require.NoError(t, it.Error())
+	}
+}
+
+func TestBlockCorrupted(t *testing.T) {
+	_, err := newBlockIterator([]byte{1, 0})
+	require.Error(t, err)
+
+	_, err = newBlockIterator([]byte{0xff, 0, 0, 0})
+	require.Error(t, err)
+
+	raw := buildBlock(t, 10, 4)
+	raw[0] = 0x80 // 第一个entry的shared不再是合法的varint
+	it, err := newBlockIterator(raw)
+	require.NoError(t, err)
+	it.SeekToFirst()
+	require.False(t, it.Vaild())
+	require.Error(t, it.Error())
+}
+
+func TestDataBlockIteratorValueChecksum(t *testing.T) {
+	b := newBlockBuilder(16)
+	for i := 0; i < 10; i++ {
+		b.addEntry(blockKey(i), x.ValueStruct{Meta: x.BitChecksum, Value: []byte(fmt.Sprintf("val%d", i))})
+	}
+	raw := b.finish()
+	// 破坏第一个value
+	raw[bytes.Index(raw, []byte("val0"))] ^= 0xff
+
+	// Seek经过的entry不校验，停下的entry校验后缓存
+	it, err := newDataBlockIterator(raw)
+	require.NoError(t, err)
+	it.Seek(blockKey(5))
+	require.True(t, it.Vaild())
+	require.Equal(t, "val5", string(it.Value().Value))
+	require.Equal(t, x.BitChecksum, it.Value().Meta)
+
+	it.SeekToFirst()
+	require.False(t, it.Vaild())
+	require.ErrorIs(t, it.Error(), x.ErrChecksumMismatch)
+}
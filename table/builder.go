@@ -1 +1,299 @@
 package table
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/YzmjY/toykv/bloomfilter"
+	"github.com/YzmjY/toykv/x"
+)
+
+var (
+	ErrKeyOrder = errors.New("table: keys must be added in strictly increasing order")
+	// ErrKeyTooShort key必须是带时间戳的内部key
+	ErrKeyTooShort = errors.New("table: key is not an internal key")
+)
+
+// checkKeyOrder 检查key是合法的内部key并且大于lastKey，lastKey为空表示第一个key。
+// key来自调用方，不能直接交给x.KeysCompare
+func checkKeyOrder(lastKey, key []byte) error {
+	if _, err := x.ParseInternalKey(key); err != nil {
+		return fmt.Errorf("%w: %w", ErrKeyTooShort, err)
+	}
+	if len(lastKey) == 0 {
+		return nil
+	}
+	cmp, err := x.CompareInternalKeys(lastKey, key)
+	if err == nil && cmp >= 0 {
+		err = fmt.Errorf("%w: %q after %q", ErrKeyOrder, key, lastKey)
+	}
+	return err
+}
+
+// Builder 把有序的kv写成一个table
+type Builder struct {
+	opts        Options
+	w           io.Writer
+	compression CompressionType
+
+	offset    uint64 // 已经写入的字节数
+	dataBlock *blockBuilder
+	index     *indexBuilder
+
+	filter            bloomfilter.FilterBuilder
+	partitionedFilter *bloomfilter.PartitionedFilterBuilder
+
+	lastKey    []byte
+	props      Properties
+	collectors propertiesCollectors
+	rangeDels  []RangeTombstone
+
+	err error
+}
+
+func NewBuilder(w io.Writer, opts Options) *Builder {
+	b := &Builder{
+		opts:        opts,
+		w:           w,
+		compression: opts.CompressionForLevel(opts.Level),
+		dataBlock:   newBlockBuilder(opts.BlockRestartInterval),
+		index:       newIndexBuilder(opts.IndexPartitionSize),
+	}
+
+	if opts.FilterPolicy != nil {
+		if opts.FilterBlocksPerPartition > 0 {
+			b.partitionedFilter = bloomfilter.NewPartitionedFilterBuilder(opts.FilterPolicy, opts.FilterBlocksPerPartition)
+		} else {
+			b.filter = opts.FilterPolicy.NewBuilder()
+		}
+	}
+	b.dataBlock.hashIndex = opts.DataBlockHashIndex
+	b.collectors = newPropertiesCollectors(opts)
+
+	return b
+}
+
+// Add 添加一个kv，key为带时间戳的内部key，需要严格递增。
+// key不合法时返回错误，之后的调用都返回同样的错误
+func (b *Builder) Add(key []byte, v x.ValueStruct) error {
+	if b.err != nil {
+		return b.err
+	}
+	if b.err = checkKeyOrder(b.lastKey, key); b.err != nil {
+		return b.err
+	}
+
+	b.index.onKey(key)
+	b.dataBlock.addEntry(key, b.opts.encodedValue(v))
+	if b.filter != nil {
+		b.filter.AddKey(x.ParseUserKey(key))
+	}
+	if b.partitionedFilter != nil {
+		b.partitionedFilter.Add(key)
+	}
+
+	b.props.add(key, v)
+	if b.err = b.collectors.add(key, v); b.err != nil {
+		return b.err
+	}
+	b.lastKey = append(b.lastKey[:0], key...)
+
+	if b.dataBlock.estimatedSize() >= b.opts.BlockSize {
+		b.flushDataBlock()
+	}
+	return b.err
+}
+
+// Empty 是否还没有添加任何kv
+func (b *Builder) Empty() bool {
+	return b.props.NumEntries == 0
+}
+
+// EstimatedSize 如果此时调用Finish，table文件大约的大小，尚未写出的block按压缩前的大小计算
+func (b *Builder) EstimatedSize() uint64 {
+	size := b.offset + uint64(b.dataBlock.estimatedSize()) + uint64(b.index.estimatedSize())
+	if b.filter != nil {
+		size += uint64(b.filter.EstimatedSize())
+	}
+	if b.partitionedFilter != nil {
+		size += uint64(b.partitionedFilter.EstimatedSize())
+	}
+	return size + footerSize
+}
+
+func (b *Builder) flushDataBlock() {
+	if b.dataBlock.empty() {
+		return
+	}
+
+	data := b.dataBlock.finish()
+	handle := b.writeBlockWith(data, b.compression)
+	b.dataBlock.reset()
+	if b.err != nil {
+		return
+	}
+	b.props.NumDataBlocks++
+	b.props.RawDataSize += uint64(len(data))
+	b.props.DataSize += handle.size
+
+	b.index.addBlock(b.lastKey, handle)
+	if b.partitionedFilter != nil {
+		b.partitionedFilter.FinishBlock()
+	}
+}
+
+// writeBlock 写入一个不压缩的block及其trailer
+func (b *Builder) writeBlock(data []byte) blockHandle {
+	return b.writeBlockWith(data, NoCompression)
+}
+
+// writeBlockWith 按照compression压缩后写入block及其trailer
+func (b *Builder) writeBlockWith(data []byte, compression CompressionType) blockHandle {
+	data, compression = compressBlock(compression, data)
+	handle := blockHandle{offset: b.offset, size: uint64(len(data))}
+
+	var trailer [blockTrailerSize]byte
+	trailer[0] = byte(compression)
+	binary.LittleEndian.PutUint32(trailer[1:], checksum(data, compression))
+	b.write(data)
+	b.write(trailer[:])
+	return handle
+}
+
+func (b *Builder) write(data []byte) {
+	if b.err != nil {
+		return
+	}
+
+	if _, err := b.w.Write(data); err != nil {
+		b.err = err
+		return
+	}
+	b.offset += uint64(len(data))
+}
+
+// AddRangeDeletion 添加一个范围删除，删除userKey在[start, end)之间、版本不大于version的key。
+// 范围删除与Add的顺序无关，Finish时排序后写入单独的meta block。
+// start不小于end时返回ErrBadRange，version超出x.MaxVersion时返回x.ErrVersionTooLarge，
+// 与Add的错误一样之后的调用都会失败
+func (b *Builder) AddRangeDeletion(start, end []byte, version uint64) error {
+	if b.err != nil {
+		return b.err
+	}
+	if bytes.Compare(start, end) >= 0 {
+		b.err = fmt.Errorf("%w: [%q, %q)", ErrBadRange, start, end)
+		return b.err
+	}
+	if b.err = x.CheckVersion(version); b.err != nil {
+		return b.err
+	}
+	b.rangeDels = append(b.rangeDels, RangeTombstone{
+		Start:   append([]byte(nil), start...),
+		End:     append([]byte(nil), end...),
+		Version: version,
+	})
+	b.props.NumRangeDeletions++
+	return nil
+}
+
+// Finish 写入剩余的data block、index block、meta block以及footer
+func (b *Builder) Finish() error {
+	if b.err != nil {
+		return b.err
+	}
+	b.flushDataBlock()
+	b.props.Biggest = append([]byte(nil), b.lastKey...)
+
+	f := footer{version: formatVersion}
+	index, partitioned := b.index.finish(func(data []byte) blockHandle {
+		h := b.writeBlockWith(data, b.compression)
+		b.props.IndexSize += h.size
+		return h
+	})
+	if partitioned {
+		f.version = formatVersionPartitionedIndex
+	}
+	f.index = b.writeBlockWith(index, b.compression)
+	b.props.IndexSize += f.index.size
+
+	metaindex := newBlockBuilder(1)
+	if b.opts.FilterPolicy != nil {
+		// metaindex中的key需要有序
+		if b.filter != nil {
+			handle := b.writeBlock(b.filter.Finish(nil))
+			b.props.FilterSize += handle.size
+			metaindex.add([]byte(metaFilter), handle.encode(nil))
+		}
+		if b.partitionedFilter != nil {
+			// 每个分区单独作为一个block写入，索引中记录的是分区block的handle
+			index, _ := b.partitionedFilter.FinishWith(func(filter []byte) (uint64, uint64, error) {
+				h := b.writeBlock(filter)
+				b.props.FilterSize += h.size
+				return h.offset, h.size, nil
+			})
+			indexHandle := b.writeBlock(index)
+			b.props.FilterSize += indexHandle.size
+			metaindex.add([]byte(metaFilterPartitionIdx), indexHandle.encode(nil))
+		}
+		metaindex.add([]byte(metaFilterPolicy), bloomfilter.MetaOf(b.opts.FilterPolicy).Encode(nil))
+		b.props.FilterPolicy = b.opts.FilterPolicy.Name()
+	}
+
+	if err := b.collectors.finish(&b.props); err != nil {
+		return err
+	}
+	propsHandle := b.writeBlock(b.props.encode())
+	metaindex.add([]byte(metaProperties), propsHandle.encode(nil))
+	if len(b.rangeDels) > 0 {
+		h := b.writeBlock(encodeRangeDels(b.rangeDels))
+		metaindex.add([]byte(metaRangeDel), h.encode(nil))
+	}
+
+	f.metaindex = b.writeBlock(metaindex.finish())
+	b.write(f.encode(nil))
+
+	return b.err
+}
+
+// BuildFromIterator 把一个正向迭代器中的所有kv写成table，格式由opts.Level决定
+func BuildFromIterator(w io.Writer, iter x.Iterator, opts Options) error {
+	b := NewTableBuilder(w, opts)
+	for iter.Rewind(); iter.Vaild(); iter.Next() {
+		if err := b.Add(iter.Key(), iter.Value()); err != nil {
+			return err
+		}
+	}
+
+	return b.Finish()
+}
+
+// BuildTable 把一个正向迭代器中的所有kv写入path对应的table文件
+func BuildTable(path string, iter x.Iterator, opts Options) (err error) {
+	fs := opts.FileSystem()
+	f, err := fs.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			fs.Remove(path)
+		}
+	}()
+
+	w := bufio.NewWriterSize(f, 1<<20)
+	if err = BuildFromIterator(w, iter, opts); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
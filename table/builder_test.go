@@ -0,0 +1,150 @@
+package table
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/YzmjY/toykv/skiplist"
+	"github.com/YzmjY/toykv/x"
+	"github.com/stretchr/testify/require"
+)
+
+func tableKey(i int) []byte {
+	return x.KeyWithTs([]byte(fmt.Sprintf("key%06d", i)), uint64(i%7+1))
+}
+
+func tableValue(i int) x.ValueStruct {
+	return x.ValueStruct{Meta: byte(i % 3), UserMeta: 1, Value: []byte(fmt.Sprintf("value%d", i))}
+}
+
+func TestBuildFromSkiplist(t *testing.T) {
+	const n = 5000
+	skl := skiplist.NewSkiplist(1 << 22)
+	for i := 0; i < n; i++ {
+		skl.Put(tableKey(i), tableValue(i))
+	}
+	iter := skl.NewUinIterator(false)
+	defer iter.Close()
+
+	opts := DefaultOptions()
+	opts.BlockSize = 1024
+	opts.Compression = NoCompression // 下面直接解析block
+
+	var buf bytes.Buffer
+	require.NoError(t, BuildFromIterator(&buf, iter, opts))
+	data := buf.Bytes()
+
+	f, err := decodeFooter(data[len(data)-footerSize:])
+	require.NoError(t, err)
+
+	// 通过index block遍历所有data block
+	indexIter, err := newBlockIterator(data[f.index.offset : f.index.offset+f.index.size])
+	require.NoError(t, err)
+
+	i, nBlocks := 0, 0
+	var lastSep []byte
+	for indexIter.SeekToFirst(); indexIter.Vaild(); indexIter.Next() {
+		if lastSep != nil {
+			// 上一个block的分隔符小于这个block的第一个key
+			require.Less(t, x.KeysCompare(lastSep, tableKey(i)), 0)
+		}
+		h, err := decodeBlockHandle(indexIter.RawValue())
+		require.NoError(t, err)
+		require.LessOrEqual(t, h.size, uint64(opts.BlockSize*2))
+
+		require.EqualValues(t, NoCompression, data[h.offset+h.size])
+		blockIter, err := newBlockIterator(data[h.offset : h.offset+h.size])
+		require.NoError(t, err)
+		for blockIter.SeekToFirst(); blockIter.Vaild(); blockIter.Next() {
+			require.Equal(t, tableKey(i), blockIter.Key())
+			require.Equal(t, tableValue(i).Value, blockIter.Value().Value)
+			i++
+		}
+		blockIter.SeekToLast()
+		require.LessOrEqual(t, x.KeysCompare(blockIter.Key(), indexIter.Key()), 0)
+		lastSep = append(lastSep[:0], indexIter.Key()...)
+		nBlocks++
+	}
+	require.Equal(t, n, i)
+	require.Greater(t, nBlocks, 10)
+}
+
+func TestBuilderEstimatedSize(t *testing.T) {
+	var buf bytes.Buffer
+	opts := DefaultOptions()
+	opts.Compression = NoCompression
+	b := NewBuilder(&buf, opts)
+	require.True(t, b.Empty())
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, b.Add(tableKey(i), tableValue(i)))
+	}
+	require.False(t, b.Empty())
+
+	estimated := b.EstimatedSize()
+	require.NoError(t, b.Finish())
+	require.InEpsilon(t, buf.Len(), estimated, 0.1)
+}
+
+func TestBuilderKeyOrder(t *testing.T) {
+	var buf bytes.Buffer
+	b := NewBuilder(&buf, DefaultOptions())
+	require.NoError(t, b.Add(x.KeyWithTs([]byte("b"), 1), x.ValueStruct{Value: []byte("v")}))
+	err := b.Add(x.KeyWithTs([]byte("a"), 1), x.ValueStruct{Value: []byte("v")})
+	require.ErrorIs(t, err, ErrKeyOrder)
+	// 错误会一直保留
+	require.ErrorIs(t, b.Add(x.KeyWithTs([]byte("c"), 1), x.ValueStruct{}), ErrKeyOrder)
+	require.ErrorIs(t, b.Finish(), ErrKeyOrder)
+
+	b = NewBuilder(&buf, DefaultOptions())
+	require.ErrorIs(t, b.Add([]byte("short"), x.ValueStruct{}), ErrKeyTooShort)
+
+	// 未知的操作类型
+	key := x.KeyWithTs([]byte("a"), 1)
+	key[len(key)-1] = 0xff
+	b = NewBuilder(&buf, DefaultOptions())
+	err = b.Add(key, x.ValueStruct{})
+	require.ErrorIs(t, err, ErrKeyTooShort)
+	require.ErrorIs(t, err, x.ErrBadInternalKey)
+}
+
+func TestBuilderBadRangeDeletion(t *testing.T) {
+	b := NewBuilder(&bytes.Buffer{}, DefaultOptions())
+	require.NoError(t, b.AddRangeDeletion([]byte("a"), []byte("b"), 0))
+	require.ErrorIs(t, b.AddRangeDeletion([]byte("b"), []byte("b"), 0), ErrBadRange)
+	require.ErrorIs(t, b.Add(x.KeyWithTs([]byte("a"), 1), x.ValueStruct{}), ErrBadRange)
+	require.ErrorIs(t, b.Finish(), ErrBadRange)
+
+	b = NewBuilder(&bytes.Buffer{}, DefaultOptions())
+	require.ErrorIs(t, b.AddRangeDeletion([]byte("a"), []byte("b"), x.MaxVersion+1), x.ErrVersionTooLarge)
+	require.ErrorIs(t, b.Finish(), x.ErrVersionTooLarge)
+}
+
+func TestBuilderKeepsValueChecksum(t *testing.T) {
+	// 没有开启ValueChecksums时，写入方设置的x.BitChecksum原样保留
+	for _, format := range []TableFormat{BlockBasedFormat, PlainFormat} {
+		opts := DefaultOptions()
+		opts.Format = format
+		path := filepath.Join(t.TempDir(), "checksum.sst")
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		b := NewTableBuilder(f, opts)
+		require.NoError(t, b.Add(x.KeyWithTs([]byte("a"), 1), x.ValueStruct{Meta: x.BitChecksum | x.BitDelete, Value: []byte("v")}))
+		require.NoError(t, b.Add(x.KeyWithTs([]byte("b"), 1), x.ValueStruct{Value: []byte("v")}))
+		require.NoError(t, b.Finish())
+		require.NoError(t, f.Close())
+
+		r, err := OpenReader(path, opts)
+		require.NoError(t, err)
+		v, err := r.Get(x.KeyWithTs([]byte("a"), 1))
+		require.NoError(t, err)
+		require.Equal(t, x.BitChecksum|x.BitDelete, v.Meta)
+		require.Equal(t, []byte("v"), v.Value)
+		v, err = r.Get(x.KeyWithTs([]byte("b"), 1))
+		require.NoError(t, err)
+		require.Zero(t, v.Meta)
+		require.NoError(t, r.Close())
+	}
+}
@@ -0,0 +1,71 @@
+package table
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CompressionType block的压缩算法，记录在每个block的trailer中
+type CompressionType uint8
+
+const (
+	NoCompression CompressionType = iota
+	SnappyCompression
+	// FlateCompression 压缩率更高但更慢，适合冷数据所在的底层
+	FlateCompression
+)
+
+func (c CompressionType) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case SnappyCompression:
+		return "snappy"
+	case FlateCompression:
+		return "flate"
+	default:
+		return fmt.Sprintf("CompressionType(%d)", uint8(c))
+	}
+}
+
+var errUnknownCompression = errors.New("table: unknown compression type")
+
+// compressBlock 压缩block，压缩率不足12.5%时保存原始数据
+func compressBlock(c CompressionType, raw []byte) ([]byte, CompressionType) {
+	var compressed []byte
+	switch c {
+	case SnappyCompression:
+		compressed = snappyEncode(nil, raw)
+	case FlateCompression:
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+		w.Write(raw)
+		w.Close()
+		compressed = buf.Bytes()
+	default:
+		return raw, NoCompression
+	}
+
+	if len(compressed) >= len(raw)-len(raw)/8 {
+		return raw, NoCompression
+	}
+	return compressed, c
+}
+
+func decompressBlock(c CompressionType, data []byte) ([]byte, error) {
+	switch c {
+	case NoCompression:
+		return data, nil
+	case SnappyCompression:
+		return snappyDecode(data)
+	case FlateCompression:
+		r := flate.NewReader(bytes.NewReader(data))
+		defer r.Close()
+		return io.ReadAll(r)
+	default:
+		return nil, errUnknownCompression
+	}
+}
@@ -0,0 +1,149 @@
+package table
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/YzmjY/toykv/x"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnappyRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 100000)
+	rng.Read(random)
+
+	inputs := [][]byte{
+		nil,
+		[]byte("a"),
+		[]byte("short literal"),
+		bytes.Repeat([]byte("a"), 1000),
+		bytes.Repeat([]byte("abcdefgh12345678"), 10000),
+		random,
+		// 超过64KB的offset需要copy4
+		append(append(append([]byte(nil), random...), random[:1000]...), random[:70000]...),
+	}
+	for i, in := range inputs {
+		enc := snappyEncode(nil, in)
+		dec, err := snappyDecode(enc)
+		require.NoError(t, err, "input %d", i)
+		require.Equal(t, len(in), len(dec), "input %d", i)
+		require.True(t, bytes.Equal(in, dec), "input %d", i)
+	}
+
+	enc := snappyEncode(nil, bytes.Repeat([]byte("abcdefgh"), 1000))
+	require.Less(t, len(enc), 8000/10)
+}
+
+func TestSnappyDecodeKnown(t *testing.T) {
+	// "abcabcabc"：literal "abc"，然后copy1(offset=3, len=6)
+	dec, err := snappyDecode([]byte{9, 2 << 2, 'a', 'b', 'c', 2<<2 | snappyTagCopy1, 3})
+	require.NoError(t, err)
+	require.Equal(t, "abcabcabc", string(dec))
+}
+
+func TestSnappyDecodeCorrupted(t *testing.T) {
+	enc := snappyEncode(nil, bytes.Repeat([]byte("0123456789"), 100))
+	for i := 0; i < len(enc); i++ {
+		_, _ = snappyDecode(enc[:i])
+	}
+
+	_, err := snappyDecode([]byte{10, 0 << 2, 'a'})
+	require.Error(t, err)
+	// offset超出已解压的数据
+	_, err = snappyDecode([]byte{8, 0 << 2, 'a', 3<<2 | snappyTagCopy2, 5, 0})
+	require.Error(t, err)
+	// 头部声明的长度远大于压缩数据能解压出的长度
+	hdr := binary.AppendUvarint(nil, 1<<31)
+	_, err = snappyDecode(append(hdr, 0<<2, 'a', 1<<2|snappyTagCopy1, 1))
+	require.Error(t, err)
+
+	// 压缩率最高的输入仍然在限制之内
+	zeros := make([]byte, 1<<20)
+	dec, err := snappyDecode(snappyEncode(nil, zeros))
+	require.NoError(t, err)
+	require.Equal(t, zeros, dec)
+}
+
+func TestCompressBlockThreshold(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 4096)
+	rng.Read(random)
+
+	for _, c := range []CompressionType{SnappyCompression, FlateCompression} {
+		// 随机数据压缩不了，保存原始数据
+		data, got := compressBlock(c, random)
+		require.Equal(t, NoCompression, got)
+		require.Equal(t, random, data)
+
+		text := bytes.Repeat([]byte("hello toykv "), 400)
+		data, got = compressBlock(c, text)
+		require.Equal(t, c, got)
+		require.Less(t, len(data), len(text)/2)
+
+		dec, err := decompressBlock(got, data)
+		require.NoError(t, err)
+		require.Equal(t, text, dec)
+	}
+}
+
+func TestCompressionForLevel(t *testing.T) {
+	opts := DefaultOptions()
+	require.Equal(t, SnappyCompression, opts.CompressionForLevel(3))
+
+	opts.LevelCompression = []CompressionType{NoCompression, SnappyCompression, SnappyCompression, FlateCompression}
+	require.Equal(t, NoCompression, opts.CompressionForLevel(0))
+	require.Equal(t, SnappyCompression, opts.CompressionForLevel(2))
+	require.Equal(t, FlateCompression, opts.CompressionForLevel(3))
+	require.Equal(t, FlateCompression, opts.CompressionForLevel(6))
+}
+
+func TestTableCompression(t *testing.T) {
+	const n = 5000
+	value := func(i int) []byte {
+		return []byte(fmt.Sprintf("user-%d,status=active,region=us-east-1,tier=gold", i%10))
+	}
+
+	sizes := make(map[CompressionType]uint64)
+	for _, c := range []CompressionType{NoCompression, SnappyCompression, FlateCompression} {
+		t.Run(c.String(), func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Compression = c
+
+			path := filepath.Join(t.TempDir(), "000001.sst")
+			f, err := os.Create(path)
+			require.NoError(t, err)
+			b := NewBuilder(f, opts)
+			for i := 0; i < n; i++ {
+				require.NoError(t, b.Add(tableKey(i), x.ValueStruct{Value: value(i)}))
+			}
+			require.NoError(t, b.Finish())
+			require.NoError(t, f.Close())
+
+			tbl, err := Open(path, opts)
+			require.NoError(t, err)
+			defer tbl.Close()
+			sizes[c] = tbl.Size()
+
+			for i := 0; i < n; i += 13 {
+				v, err := tbl.Get(tableKey(i))
+				require.NoError(t, err)
+				require.Equal(t, value(i), v.Value)
+			}
+			it := tbl.NewIterator(false)
+			defer it.Close()
+			cnt := 0
+			for it.Rewind(); it.Vaild(); it.Next() {
+				cnt++
+			}
+			require.Equal(t, n, cnt)
+		})
+	}
+	require.Less(t, sizes[SnappyCompression], sizes[NoCompression])
+	require.Less(t, sizes[FlateCompression], sizes[SnappyCompression])
+}
@@ -0,0 +1,75 @@
+package table
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrCorruption 所有数据损坏的错误都可以用errors.Is(err, ErrCorruption)判断，
+// 具体的位置信息通过errors.As得到*CorruptionError
+var ErrCorruption = errors.New("table: corruption")
+
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// BlockType block的类型，用于报告损坏的位置
+type BlockType uint8
+
+const (
+	BlockTypeData BlockType = iota
+	BlockTypeIndex
+	BlockTypeIndexPartition
+	BlockTypeMetaIndex
+	BlockTypeFilter
+	BlockTypeFilterIndex
+	BlockTypeFilterPartition
+	BlockTypeProperties
+	BlockTypeFooter
+	// BlockTypeRecord plain table中的record
+	BlockTypeRecord
+	BlockTypeRangeDel
+)
+
+func (t BlockType) String() string {
+	switch t {
+	case BlockTypeData:
+		return "data"
+	case BlockTypeIndex:
+		return "index"
+	case BlockTypeIndexPartition:
+		return "index partition"
+	case BlockTypeMetaIndex:
+		return "metaindex"
+	case BlockTypeFilter:
+		return "filter"
+	case BlockTypeFilterIndex:
+		return "filter index"
+	case BlockTypeFilterPartition:
+		return "filter partition"
+	case BlockTypeProperties:
+		return "properties"
+	case BlockTypeFooter:
+		return "footer"
+	case BlockTypeRecord:
+		return "record"
+	case BlockTypeRangeDel:
+		return "range deletion"
+	default:
+		return fmt.Sprintf("BlockType(%d)", uint8(t))
+	}
+}
+
+// CorruptionError table文件中某个block损坏
+type CorruptionError struct {
+	File      string
+	Offset    uint64
+	BlockType BlockType
+	Err       error // 具体的原因
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("table: corruption in %s block at offset %d of %s: %v", e.BlockType, e.Offset, e.File, e.Err)
+}
+
+func (e *CorruptionError) Unwrap() []error {
+	return []error{ErrCorruption, e.Err}
+}
@@ -0,0 +1,138 @@
+package table
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"unsafe"
+
+	"github.com/YzmjY/toykv/vfs"
+)
+
+// LoadingMode table文件的读取方式
+type LoadingMode int
+
+const (
+	// LoadingModeMmap 把整个文件映射到内存，读取时不需要拷贝
+	LoadingModeMmap LoadingMode = iota
+	// LoadingModePread 每次读取block时调用pread，适合内存受限、不希望映射大文件的场景
+	LoadingModePread
+)
+
+func (m LoadingMode) String() string {
+	switch m {
+	case LoadingModeMmap:
+		return "mmap"
+	case LoadingModePread:
+		return "pread"
+	default:
+		return fmt.Sprintf("LoadingMode(%d)", int(m))
+	}
+}
+
+// fileReader 对table文件的随机读
+type fileReader interface {
+	// readAt 读取[offset, offset+size)。mmap模式下返回的是映射的内存，调用方不能修改
+	readAt(offset, size uint64) ([]byte, error)
+	size() uint64
+	close() error
+}
+
+// openFileReader direct只对LoadingModePread有效
+func openFileReader(fs vfs.FS, path string, mode LoadingMode, direct bool) (fileReader, error) {
+	var f vfs.File
+	var err error
+	if mode == LoadingModePread && direct {
+		f, direct, err = vfs.OpenDirect(fs, path)
+	} else {
+		f, err = fs.Open(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	switch mode {
+	case LoadingModeMmap:
+		osFile, ok := f.(*os.File)
+		if !ok {
+			// 不是操作系统上的文件，无法映射，退化为pread
+			return &preadReader{f: f, n: uint64(fi.Size())}, nil
+		}
+		r, err := newMmapReader(osFile, uint64(fi.Size()))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return r, nil
+	case LoadingModePread:
+		return &preadReader{f: f, n: uint64(fi.Size()), direct: direct}, nil
+	default:
+		f.Close()
+		return nil, fmt.Errorf("table: unknown loading mode %v", mode)
+	}
+}
+
+type preadReader struct {
+	f vfs.File
+	n uint64
+	// direct 文件以O_DIRECT打开，读取需要对齐
+	direct bool
+}
+
+func (r *preadReader) readAt(offset, size uint64) ([]byte, error) {
+	if offset+size > r.n || offset+size < offset {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if r.direct {
+		return r.readDirect(offset, size)
+	}
+
+	buf := make([]byte, size)
+	if _, err := r.f.ReadAt(buf, int64(offset)); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (r *preadReader) size() uint64 {
+	return r.n
+}
+
+func (r *preadReader) close() error {
+	return r.f.Close()
+}
+
+// directIOAlignment O_DIRECT要求文件偏移、读取长度和内存地址都按这个大小对齐
+const directIOAlignment = 4096
+
+// readDirect 把[offset, offset+size)扩展到对齐的范围读取，返回其中需要的部分
+func (r *preadReader) readDirect(offset, size uint64) ([]byte, error) {
+	start := offset &^ (directIOAlignment - 1)
+	end := (offset + size + directIOAlignment - 1) &^ (directIOAlignment - 1)
+	buf := alignedBuffer(int(end - start))
+
+	n, err := r.f.ReadAt(buf, int64(start))
+	// 文件末尾不足一个对齐单位，读到的数据够用即可
+	if uint64(n) < offset+size-start {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	begin := offset - start
+	return buf[begin : begin+size : begin+size], nil
+}
+
+func alignedBuffer(size int) []byte {
+	buf := make([]byte, size+directIOAlignment)
+	off := int(uintptr(unsafe.Pointer(&buf[0])) & (directIOAlignment - 1))
+	if off != 0 {
+		off = directIOAlignment - off
+	}
+	return buf[off : off+size : off+size]
+}
@@ -0,0 +1,123 @@
+package table
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// table文件的格式：
+//
+//	| data block 0 | ... | data block n-1 | index block | meta block 0 | ... | metaindex block | footer |
+//
+// 除footer外，每个block之后都有一个trailer，blockHandle中的size不包括trailer：
+//
+//	| block（可能经过压缩） | compression(1字节) | crc32c(uint32) |
+//
+// crc32c覆盖block和compression字节。
+//
+// index block：每个data block一项，见index.go。
+// version为formatVersionPartitionedIndex时index分成多个分区block，写在顶层index之前，
+// footer中的index为顶层index，每个分区一项，key为分区中最后一个key，value为分区的handle。
+// metaindex block：key为meta block的名字，value为meta block的handle，
+// 过滤器、属性（见properties.go）等都作为meta block保存。
+// footer定长，位于文件末尾：
+//
+//	| metaindex handle(2*uint64) | index handle(2*uint64) | version(uint32) | magic(uint64) |
+
+const (
+	tableMagic    uint64 = 0x746f796b762e7462 // "toykv.tb"
+	formatVersion uint32 = 1
+	// formatVersionPartitionedIndex 两层的分区index
+	formatVersionPartitionedIndex uint32 = 2
+
+	footerSize = 4*8 + 4 + 8
+
+	blockTrailerSize = 1 + 4
+
+	// meta block的名字
+	metaFilterPolicy       = "filter.policy"
+	metaFilter             = "filter.full"
+	metaFilterPartitionIdx = "filter.partition_index"
+	metaProperties         = "toykv.properties"
+	metaRangeDel           = "toykv.range_del"
+)
+
+var (
+	errBadMagic   = errors.New("table: bad magic number")
+	errBadVersion = errors.New("table: unsupported format version")
+	errBadHandle  = errors.New("table: bad block handle")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// checksum block内容和compression字节的crc32c
+func checksum(data []byte, c CompressionType) uint32 {
+	crc := crc32.Update(0, crcTable, data)
+	return crc32.Update(crc, crcTable, []byte{byte(c)})
+}
+
+// blockHandle 一个block在文件中的位置
+type blockHandle struct {
+	offset uint64
+	size   uint64
+}
+
+func (h blockHandle) encode(dst []byte) []byte {
+	dst = binary.AppendUvarint(dst, h.offset)
+	dst = binary.AppendUvarint(dst, h.size)
+	return dst
+}
+
+func decodeBlockHandle(src []byte) (blockHandle, error) {
+	var h blockHandle
+	offset, n := binary.Uvarint(src)
+	if n <= 0 {
+		return h, errBadHandle
+	}
+	size, m := binary.Uvarint(src[n:])
+	if m <= 0 {
+		return h, errBadHandle
+	}
+
+	h.offset, h.size = offset, size
+	return h, nil
+}
+
+type footer struct {
+	metaindex blockHandle
+	index     blockHandle
+	version   uint32
+}
+
+func (f footer) encode(dst []byte) []byte {
+	dst = binary.LittleEndian.AppendUint64(dst, f.metaindex.offset)
+	dst = binary.LittleEndian.AppendUint64(dst, f.metaindex.size)
+	dst = binary.LittleEndian.AppendUint64(dst, f.index.offset)
+	dst = binary.LittleEndian.AppendUint64(dst, f.index.size)
+	dst = binary.LittleEndian.AppendUint32(dst, f.version)
+	dst = binary.LittleEndian.AppendUint64(dst, tableMagic)
+	return dst
+}
+
+func decodeFooter(src []byte) (footer, error) {
+	var f footer
+	if len(src) != footerSize {
+		return f, errBadMagic
+	}
+	if binary.LittleEndian.Uint64(src[36:]) != tableMagic {
+		return f, errBadMagic
+	}
+
+	f.metaindex.offset = binary.LittleEndian.Uint64(src[0:])
+	f.metaindex.size = binary.LittleEndian.Uint64(src[8:])
+	f.index.offset = binary.LittleEndian.Uint64(src[16:])
+	f.index.size = binary.LittleEndian.Uint64(src[24:])
+	f.version = binary.LittleEndian.Uint32(src[32:])
+	if f.version != formatVersion && f.version != formatVersionPartitionedIndex {
+		return f, fmt.Errorf("%w: %d", errBadVersion, f.version)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,118 @@
+package table
+
+import (
+	"errors"
+
+	"github.com/YzmjY/toykv/x"
+)
+
+// ErrGlobalVersion 使用全局版本打开的table中所有key和范围删除的版本都必须是0
+var ErrGlobalVersion = errors.New("table: table opened with a global version has non-zero versions")
+
+// globalVersionReader 外部导入的table中key的版本都是0，读取时统一视为version，
+// 由Options.GlobalVersion开启。Properties返回的仍然是文件中原始的统计
+type globalVersionReader struct {
+	Reader
+	version uint64
+
+	smallest  []byte
+	biggest   []byte
+	rangeDels []RangeTombstone
+}
+
+func newGlobalVersionReader(r Reader, version uint64) (Reader, error) {
+	if r.MaxVersion() != 0 {
+		return nil, ErrGlobalVersion
+	}
+	g := &globalVersionReader{Reader: r, version: version}
+	if r.KeyCount() > 0 {
+		g.smallest = withVersion(r.Smallest(), version)
+		g.biggest = withVersion(r.Biggest(), version)
+	}
+	for _, d := range r.RangeDeletions() {
+		if d.Version != 0 {
+			return nil, ErrGlobalVersion
+		}
+		d.Version = version
+		g.rangeDels = append(g.rangeDels, d)
+	}
+	return g, nil
+}
+
+// withVersion 把内部key的版本替换为version，保留操作类型
+func withVersion(key []byte, version uint64) []byte {
+	return x.MakeInternalKey(x.ParseUserKey(key), version, x.ParseValueType(key))
+}
+
+// Get 查询的版本小于全局版本时看不到这个table中的任何key
+func (g *globalVersionReader) Get(key []byte) (x.ValueStruct, error) {
+	if _, err := x.ParseInternalKey(key); err != nil {
+		return x.ValueStruct{}, err
+	}
+	if x.ParseTs(key) < g.version {
+		return x.ValueStruct{}, nil
+	}
+	v, err := g.Reader.Get(withVersion(key, 0))
+	if err != nil || v.Value == nil {
+		return v, err
+	}
+	v.Version = g.version
+	return v, nil
+}
+
+func (g *globalVersionReader) NewIterator(reversed bool) TableIterator {
+	return &globalVersionIterator{
+		TableIterator: g.Reader.NewIterator(reversed),
+		version:       g.version,
+		reversed:      reversed,
+	}
+}
+
+func (g *globalVersionReader) Smallest() []byte {
+	return g.smallest
+}
+
+func (g *globalVersionReader) Biggest() []byte {
+	return g.biggest
+}
+
+func (g *globalVersionReader) MaxVersion() uint64 {
+	return g.version
+}
+
+func (g *globalVersionReader) RangeDeletions() []RangeTombstone {
+	return g.rangeDels
+}
+
+// globalVersionIterator 返回的key带有全局版本，每个userKey在文件中只有一个版本
+type globalVersionIterator struct {
+	TableIterator
+	version  uint64
+	reversed bool
+}
+
+func (it *globalVersionIterator) Seek(key []byte) {
+	if _, err := x.ParseInternalKey(key); err != nil {
+		// 由底层的迭代器记录错误
+		it.TableIterator.Seek(key)
+		return
+	}
+	ts := x.ParseTs(key)
+	if it.reversed {
+		// 找最后一个不大于key的位置，key的版本更大时排在全局版本之前
+		if ts > it.version {
+			it.TableIterator.Seek(withVersion(key, x.MaxVersion))
+		} else {
+			it.TableIterator.Seek(withVersion(key, 0))
+		}
+		return
+	}
+	it.TableIterator.Seek(withVersion(key, 0))
+	if ts < it.version && it.TableIterator.Vaild() && x.SameUserKey(it.TableIterator.Key(), key) {
+		it.TableIterator.Next()
+	}
+}
+
+func (it *globalVersionIterator) Key() []byte {
+	return withVersion(it.TableIterator.Key(), it.version)
+}
@@ -0,0 +1,85 @@
+package table
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/YzmjY/toykv/x"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobalVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ext.sst")
+	w, err := NewSstFileWriter(path, DefaultOptions())
+	require.NoError(t, err)
+	for i := 0; i < 100; i += 2 {
+		require.NoError(t, w.Put(x.KeyWithTs([]byte(fmt.Sprintf("key%06d", i)), 0), x.ValueStruct{Value: []byte(fmt.Sprint(i))}))
+	}
+	require.NoError(t, w.DeleteRange([]byte("a"), []byte("b"), 0))
+	_, err = w.Finish()
+	require.NoError(t, err)
+
+	for _, format := range []TableFormat{BlockBasedFormat, PlainFormat} {
+		opts := DefaultOptions()
+		opts.GlobalVersion = 7
+		if format == PlainFormat {
+			// SstFileWriter总是生成block格式
+			path = filepath.Join(t.TempDir(), "plain.sst")
+			writePlain(t, path, opts)
+		}
+		r, err := OpenReader(path, opts)
+		require.NoError(t, err)
+
+		userKey := func(i int) []byte { return []byte(fmt.Sprintf("key%06d", i)) }
+		require.EqualValues(t, 7, r.MaxVersion())
+		require.Equal(t, x.KeyWithTs(userKey(0), 7), r.Smallest())
+		require.Equal(t, x.KeyWithTs(userKey(98), 7), r.Biggest())
+
+		v, err := r.Get(x.KeyWithTs(userKey(10), 9))
+		require.NoError(t, err)
+		require.Equal(t, "10", string(v.Value))
+		require.EqualValues(t, 7, v.Version)
+		// 更早的快照看不到导入的key
+		v, err = r.Get(x.KeyWithTs(userKey(10), 6))
+		require.NoError(t, err)
+		require.Nil(t, v.Value)
+
+		it := r.NewIterator(false)
+		it.Seek(x.KeyWithTs(userKey(10), 7))
+		require.Equal(t, x.KeyWithTs(userKey(10), 7), it.Key())
+		it.Seek(x.KeyWithTs(userKey(10), 6))
+		require.Equal(t, x.KeyWithTs(userKey(12), 7), it.Key())
+		it.Close()
+
+		it = r.NewIterator(true)
+		it.Seek(x.KeyWithTs(userKey(10), 7))
+		require.Equal(t, x.KeyWithTs(userKey(10), 7), it.Key())
+		it.Seek(x.KeyWithTs(userKey(10), 8))
+		require.Equal(t, x.KeyWithTs(userKey(8), 7), it.Key())
+		it.Close()
+
+		if format == BlockBasedFormat {
+			require.Equal(t, []RangeTombstone{{Start: []byte("a"), End: []byte("b"), Version: 7}}, r.RangeDeletions())
+		}
+		require.NoError(t, r.Close())
+	}
+
+	// 带有版本的table不能使用全局版本
+	opts := DefaultOptions()
+	opts.GlobalVersion = 7
+	_, err = OpenReader(buildTestTable(t, 10, DefaultOptions()), opts)
+	require.ErrorIs(t, err, ErrGlobalVersion)
+}
+
+func writePlain(t *testing.T, path string, opts Options) {
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	b := NewPlainTableBuilder(f, opts)
+	for i := 0; i < 100; i += 2 {
+		require.NoError(t, b.Add(x.KeyWithTs([]byte(fmt.Sprintf("key%06d", i)), 0), x.ValueStruct{Value: []byte(fmt.Sprint(i))}))
+	}
+	require.NoError(t, b.Finish())
+	require.NoError(t, f.Close())
+}
@@ -1 +1,148 @@
-package table
\ No newline at end of file
+package table
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/YzmjY/toykv/x"
+)
+
+// index block中每个data block对应一项：
+//
+//	key: 介于该block最后一个key与下一个block第一个key之间的最短分隔符
+//	value: block的handle(offset, size)
+//
+// 对任意lastKey <= k < nextKey，分隔符s满足lastKey <= s < nextKey，
+// 所以在index上Seek(k)得到的仍然是第一个可能包含k的block。
+// 分隔符只缩短userKey部分，缩短之后带上最大的时间戳，即该userKey下最小的内部key
+
+type indexBuilder struct {
+	block *blockBuilder
+
+	// partitionSize 大于0时按大小切分index，partitions为已经切分出的分区
+	partitionSize int
+	partitions    []indexPartition
+	lastSep       []byte
+
+	// 上一个data block的信息，要等到下一个block的第一个key才能确定分隔符
+	pending       bool
+	pendingKey    []byte
+	pendingHandle blockHandle
+}
+
+type indexPartition struct {
+	lastKey []byte
+	data    []byte
+}
+
+func newIndexBuilder(partitionSize int) *indexBuilder {
+	return &indexBuilder{
+		block:         newBlockBuilder(1),
+		partitionSize: partitionSize,
+	}
+}
+
+// addBlock 一个data block写完时调用，lastKey为其最后一个key
+func (ib *indexBuilder) addBlock(lastKey []byte, h blockHandle) {
+	x.AssertTrue(!ib.pending)
+	ib.pending = true
+	ib.pendingKey = append(ib.pendingKey[:0], lastKey...)
+	ib.pendingHandle = h
+}
+
+// onKey 添加下一个block的第一个key之前调用
+func (ib *indexBuilder) onKey(nextKey []byte) {
+	if !ib.pending {
+		return
+	}
+	ib.add(shortestSeparator(ib.pendingKey, nextKey))
+}
+
+func (ib *indexBuilder) add(sep []byte) {
+	ib.block.add(sep, ib.pendingHandle.encode(nil))
+	ib.pending = false
+	ib.lastSep = append(ib.lastSep[:0], sep...)
+
+	if ib.partitionSize > 0 && ib.block.estimatedSize() >= ib.partitionSize {
+		ib.cutPartition()
+	}
+}
+
+func (ib *indexBuilder) cutPartition() {
+	ib.partitions = append(ib.partitions, indexPartition{
+		lastKey: append([]byte(nil), ib.lastSep...),
+		data:    ib.block.finish(),
+	})
+	ib.block = newBlockBuilder(1)
+}
+
+func (ib *indexBuilder) estimatedSize() int {
+	size := ib.block.estimatedSize()
+	if ib.pending {
+		size += len(ib.pendingKey) + 2*binary.MaxVarintLen64
+	}
+	for _, p := range ib.partitions {
+		size += len(p.data) + len(p.lastKey) + 2*binary.MaxVarintLen64
+	}
+	return size
+}
+
+// finish 返回index block。切分出了多个分区时，用write写入每个分区，
+// 返回顶层index，partitioned为true
+func (ib *indexBuilder) finish(write func(data []byte) blockHandle) (index []byte, partitioned bool) {
+	if ib.pending {
+		ib.add(shortSuccessor(ib.pendingKey))
+	}
+	if len(ib.partitions) == 0 {
+		// 只有一个分区时直接作为index
+		return ib.block.finish(), false
+	}
+	if !ib.block.empty() {
+		ib.cutPartition()
+	}
+
+	top := newBlockBuilder(1)
+	for _, p := range ib.partitions {
+		h := write(p.data)
+		top.add(p.lastKey, h.encode(nil))
+	}
+	return top.finish(), true
+}
+
+// shortestSeparator 返回满足a <= s < b的尽量短的内部key
+func shortestSeparator(a, b []byte) []byte {
+	ua, ub := x.ParseUserKey(a), x.ParseUserKey(b)
+	if bytes.Equal(ua, ub) {
+		// 同一个userKey的不同版本跨越了block
+		return a
+	}
+
+	n := len(ua)
+	if len(ub) < n {
+		n = len(ub)
+	}
+	i := 0
+	for i < n && ua[i] == ub[i] {
+		i++
+	}
+
+	if i < n && ua[i] < 0xff && ua[i]+1 < ub[i] {
+		sep := append([]byte(nil), ua[:i+1]...)
+		sep[i]++
+		return x.KeyWithTs(sep, x.MaxVersion)
+	}
+	return a
+}
+
+// shortSuccessor 返回满足a <= s的尽量短的内部key
+func shortSuccessor(a []byte) []byte {
+	ua := x.ParseUserKey(a)
+	for i, c := range ua {
+		if c != 0xff {
+			sep := append([]byte(nil), ua[:i+1]...)
+			sep[i]++
+			return x.KeyWithTs(sep, x.MaxVersion)
+		}
+	}
+	return a
+}
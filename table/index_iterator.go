@@ -0,0 +1,194 @@
+package table
+
+// indexIterator index上的迭代器，value为data block的handle。
+// 分区index时是两层迭代器：顶层index定位分区，分区在迭代到时通过block cache加载。
+// 返回的错误已经带上了出错的block的位置
+type indexIterator struct {
+	t           *Table
+	partitioned bool
+
+	top       *blockIterator
+	cur       *blockIterator // 当前分区上的迭代器，不分区时就是top
+	curHandle blockHandle
+	curType   BlockType
+
+	err error
+}
+
+// newIndexIterator 返回index上的迭代器，index block不常驻时从block cache中读取
+func (t *Table) newIndexIterator() (*indexIterator, error) {
+	index, err := t.indexBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	it := &indexIterator{
+		t:           t,
+		partitioned: t.footer.version == formatVersionPartitionedIndex,
+		top:         index.newIterator(),
+	}
+	if !it.partitioned {
+		it.cur = it.top
+		it.curHandle = t.footer.index
+		it.curType = BlockTypeIndex
+	}
+	return it, nil
+}
+
+func (it *indexIterator) Error() error {
+	return it.err
+}
+
+func (it *indexIterator) Vaild() bool {
+	return it.err == nil && it.cur != nil && it.cur.Vaild()
+}
+
+func (it *indexIterator) Key() []byte {
+	return it.cur.Key()
+}
+
+// RawValue 当前data block的handle
+func (it *indexIterator) RawValue() []byte {
+	return it.cur.RawValue()
+}
+
+// corruption 当前所在的block损坏
+func (it *indexIterator) corruption(err error) error {
+	return it.t.corruption(it.curHandle.offset, it.curType, err)
+}
+
+// checkError 记录top和当前分区上迭代器的错误
+func (it *indexIterator) checkError() bool {
+	if it.err != nil {
+		return true
+	}
+	if err := it.top.Error(); err != nil {
+		it.err = it.t.corruption(it.t.footer.index.offset, BlockTypeIndex, err)
+		return true
+	}
+	if it.cur != nil {
+		if err := it.cur.Error(); err != nil {
+			it.err = it.corruption(err)
+			return true
+		}
+	}
+	return false
+}
+
+// loadPartition 加载top当前指向的分区
+func (it *indexIterator) loadPartition() bool {
+	it.cur = nil
+	if !it.top.Vaild() {
+		it.checkError()
+		return false
+	}
+
+	h, err := decodeBlockHandle(it.top.RawValue())
+	if err != nil {
+		it.err = it.t.corruption(it.t.footer.index.offset, BlockTypeIndex, err)
+		return false
+	}
+	data, err := it.t.readBlockCached(h, BlockTypeIndexPartition)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.curHandle = h
+	it.curType = BlockTypeIndexPartition
+	if it.cur, err = newBlockIterator(data); err != nil {
+		it.cur = nil
+		it.err = it.corruption(err)
+		return false
+	}
+	return true
+}
+
+// skipForward 当前分区迭代完时移动到后面的分区
+func (it *indexIterator) skipForward() {
+	for it.partitioned && !it.checkError() && (it.cur == nil || !it.cur.Vaild()) {
+		it.top.Next()
+		if !it.loadPartition() {
+			return
+		}
+		it.cur.SeekToFirst()
+	}
+	it.checkError()
+}
+
+// skipBackward 当前分区迭代完时移动到前面的分区
+func (it *indexIterator) skipBackward() {
+	for it.partitioned && !it.checkError() && (it.cur == nil || !it.cur.Vaild()) {
+		it.top.Prev()
+		if !it.loadPartition() {
+			return
+		}
+		it.cur.SeekToLast()
+	}
+	it.checkError()
+}
+
+func (it *indexIterator) SeekToFirst() {
+	it.err = nil
+	if !it.partitioned {
+		it.top.SeekToFirst()
+		it.checkError()
+		return
+	}
+
+	it.top.SeekToFirst()
+	if !it.loadPartition() {
+		return
+	}
+	it.cur.SeekToFirst()
+	it.skipForward()
+}
+
+func (it *indexIterator) SeekToLast() {
+	it.err = nil
+	if !it.partitioned {
+		it.top.SeekToLast()
+		it.checkError()
+		return
+	}
+
+	it.top.SeekToLast()
+	if !it.loadPartition() {
+		return
+	}
+	it.cur.SeekToLast()
+	it.skipBackward()
+}
+
+// Seek 移动到第一个大于等于key的位置
+func (it *indexIterator) Seek(key []byte) {
+	it.err = nil
+	if !it.partitioned {
+		it.top.Seek(key)
+		it.checkError()
+		return
+	}
+
+	// 顶层index的key为分区中最后一个key，第一个大于等于key的分区就是要找的分区
+	it.top.Seek(key)
+	if !it.loadPartition() {
+		return
+	}
+	it.cur.Seek(key)
+	it.skipForward()
+}
+
+func (it *indexIterator) Next() {
+	if !it.Vaild() {
+		return
+	}
+	it.cur.Next()
+	it.skipForward()
+}
+
+func (it *indexIterator) Prev() {
+	if !it.Vaild() {
+		return
+	}
+	it.cur.Prev()
+	it.skipBackward()
+}
@@ -0,0 +1,139 @@
+package table
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/YzmjY/toykv/x"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortestSeparator(t *testing.T) {
+	cases := []struct {
+		a, b []byte
+		want []byte
+	}{
+		// 可以缩短
+		{x.KeyWithTs([]byte("abc1234"), 5), x.KeyWithTs([]byte("abz"), 5), x.KeyWithTs([]byte("abd"), x.MaxVersion)},
+		// 相邻的字节无法缩短
+		{x.KeyWithTs([]byte("abc"), 5), x.KeyWithTs([]byte("abd"), 5), x.KeyWithTs([]byte("abc"), 5)},
+		// a是b的前缀
+		{x.KeyWithTs([]byte("ab"), 5), x.KeyWithTs([]byte("abc"), 5), x.KeyWithTs([]byte("ab"), 5)},
+		// 同一个userKey的不同版本
+		{x.KeyWithTs([]byte("abc"), 5), x.KeyWithTs([]byte("abc"), 3), x.KeyWithTs([]byte("abc"), 5)},
+	}
+	for _, c := range cases {
+		got := shortestSeparator(c.a, c.b)
+		require.Equal(t, c.want, got)
+		require.LessOrEqual(t, x.KeysCompare(c.a, got), 0)
+		require.Less(t, x.KeysCompare(got, c.b), 0)
+	}
+}
+
+func TestShortSuccessor(t *testing.T) {
+	got := shortSuccessor(x.KeyWithTs([]byte("abc"), 5))
+	require.Equal(t, x.KeyWithTs([]byte("b"), x.MaxVersion), got)
+
+	a := x.KeyWithTs([]byte{0xff, 0xff}, 5)
+	require.Equal(t, a, shortSuccessor(a))
+}
+
+func TestPartitionedIndex(t *testing.T) {
+	const n = 5000
+	opts := DefaultOptions()
+	opts.BlockSize = 256
+	flat, err := Open(buildTestTable(t, n, opts), opts)
+	require.NoError(t, err)
+	defer flat.Close()
+	require.Equal(t, formatVersion, flat.footer.version)
+
+	opts.IndexPartitionSize = 512
+	path := buildTestTable(t, n, opts)
+	for _, cache := range []bool{false, true} {
+		t.Run(fmt.Sprintf("cache=%v", cache), func(t *testing.T) {
+			opts := opts
+			if cache {
+				opts.BlockCache = NewBlockCache(1 << 20)
+			}
+			tbl, err := Open(path, opts)
+			require.NoError(t, err)
+			defer tbl.Close()
+			require.Equal(t, formatVersionPartitionedIndex, tbl.footer.version)
+
+			for i := 0; i < n; i += 3 {
+				v, err := tbl.Get(tableKey(i))
+				require.NoError(t, err)
+				require.Equal(t, tableValue(i).Value, v.Value)
+			}
+			v, err := tbl.Get(x.KeyWithTs([]byte("zzz"), 10))
+			require.NoError(t, err)
+			require.Nil(t, v.Value)
+
+			for _, reversed := range []bool{false, true} {
+				it := tbl.NewIterator(reversed)
+				fit := flat.NewIterator(reversed)
+				cnt := 0
+				for it.Rewind(); it.Vaild(); it.Next() {
+					cnt++
+				}
+				require.NoError(t, it.Error())
+				require.Equal(t, n, cnt)
+
+				for i := 0; i < n; i += 11 {
+					for _, key := range [][]byte{tableKey(i), x.KeyWithTs([]byte(fmt.Sprintf("key%06d_", i)), 0)} {
+						it.Seek(key)
+						fit.Seek(key)
+						require.Equal(t, fit.Vaild(), it.Vaild())
+						if fit.Vaild() {
+							require.Equal(t, fit.Key(), it.Key())
+						}
+					}
+				}
+				it.Close()
+				fit.Close()
+			}
+
+			if cache {
+				stats := opts.BlockCache.Stats()
+				require.Greater(t, stats.Index.Hits, uint64(0))
+				require.Greater(t, stats.Index.Usage, int64(0))
+			}
+		})
+	}
+}
+
+func TestPartitionedIndexCorruption(t *testing.T) {
+	opts := DefaultOptions()
+	opts.BlockSize = 256
+	opts.IndexPartitionSize = 512
+	path := buildTestTable(t, 5000, opts)
+
+	tbl, err := Open(path, opts)
+	require.NoError(t, err)
+	top := tbl.index.newIterator()
+	top.SeekToLast()
+	h, err := decodeBlockHandle(top.RawValue())
+	require.NoError(t, err)
+	require.NoError(t, tbl.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[h.offset] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	// 分区按需加载，打开时不会发现
+	tbl, err = Open(path, opts)
+	require.NoError(t, err)
+	defer tbl.Close()
+
+	v, err := tbl.Get(tableKey(0))
+	require.NoError(t, err)
+	require.Equal(t, tableValue(0).Value, v.Value)
+
+	_, err = tbl.Get(tableKey(4999))
+	var cerr *CorruptionError
+	require.ErrorAs(t, err, &cerr)
+	require.Equal(t, BlockTypeIndexPartition, cerr.BlockType)
+	require.Equal(t, h.offset, cerr.Offset)
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package table
+
+import "os"
+
+type mmapReader struct {
+	preadReader
+}
+
+// newMmapReader 不支持mmap的平台上退化为pread
+func newMmapReader(f *os.File, size uint64) (*mmapReader, error) {
+	return &mmapReader{preadReader{f: f, n: size}}, nil
+}
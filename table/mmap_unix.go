@@ -0,0 +1,49 @@
+//go:build unix
+
+package table
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+type mmapReader struct {
+	f    *os.File
+	data []byte
+}
+
+func newMmapReader(f *os.File, size uint64) (*mmapReader, error) {
+	if size == 0 {
+		return &mmapReader{f: f}, nil
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	return &mmapReader{f: f, data: data}, nil
+}
+
+func (r *mmapReader) readAt(offset, size uint64) ([]byte, error) {
+	if offset+size > uint64(len(r.data)) || offset+size < offset {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return r.data[offset : offset+size : offset+size], nil
+}
+
+func (r *mmapReader) size() uint64 {
+	return uint64(len(r.data))
+}
+
+func (r *mmapReader) close() error {
+	var err error
+	if r.data != nil {
+		err = syscall.Munmap(r.data)
+		r.data = nil
+	}
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package table
+
+import (
+	"github.com/YzmjY/toykv/bloomfilter"
+	"github.com/YzmjY/toykv/vfs"
+	"github.com/YzmjY/toykv/x"
+)
+
+// Options 构造和读取table时的选项
+type Options struct {
+	// FS 读写table文件使用的文件系统，为nil时使用vfs.Default
+	FS vfs.FS
+
+	// BlockSize data block的目标大小，超过后切分出新的block
+	BlockSize int
+	// BlockRestartInterval block中重启点的间隔
+	BlockRestartInterval int
+	// DataBlockHashIndex 在data block中生成hash index，点查时不需要二分查找重启点
+	DataBlockHashIndex bool
+
+	// IndexPartitionSize 大于0时index按这个大小切分成多个分区，另外生成一个顶层index，
+	// 读取时只有顶层index常驻，分区按需加载
+	IndexPartitionSize int
+
+	// Compression 默认的block压缩算法
+	Compression CompressionType
+	// LevelCompression 不为空时按level选择压缩算法，超出长度的level使用最后一项，
+	// 例如L0不压缩、中间层snappy、底层flate
+	LevelCompression []CompressionType
+	// Level table所在的level
+	Level int
+
+	// Format 构造table时默认的格式
+	Format TableFormat
+	// LevelFormat 不为空时按level选择格式，规则与LevelCompression相同，
+	// 例如只读的点查服务可以在所有level上使用PlainFormat
+	LevelFormat []TableFormat
+
+	// FilterPolicy 为nil时不生成过滤器
+	FilterPolicy bloomfilter.FilterPoliy
+	// FilterBlocksPerPartition 大于0时使用分区过滤器，每这么多个data block生成一个分区
+	FilterBlocksPerPartition int
+
+	// ValueChecksums 给每个kv的value加上x.BitChecksum，读取时逐个校验，
+	// 在block checksum之外检查来自上游（memtable、WAL）的损坏
+	ValueChecksums bool
+
+	// PropertiesCollectors 每个Builder用这些函数创建自己的collector，收集自定义的属性
+	PropertiesCollectors []func() TablePropertiesCollector
+
+	// 以下为读取时的选项，读取时使用的过滤器由table中记录的policy决定
+
+	// LoadingMode 读取table文件的方式
+	LoadingMode LoadingMode
+	// UseDirectReads LoadingModePread下用O_DIRECT读取文件，不经过也不会污染page cache，
+	// 适用于compaction打开的table。不会自动开启，compaction打开输入table时由调用方设置。
+	// 不支持O_DIRECT的平台和文件系统上退化为普通的pread
+	UseDirectReads bool
+	// ReadaheadSize LoadingModePread下迭代器连续读取data block时开始预读，
+	// 预读大小从ReadaheadSize开始每次翻倍，最大为MaxReadaheadSize。为0时不预读
+	ReadaheadSize    int
+	MaxReadaheadSize int
+	// SkipChecksumVerification 读取data block时跳过checksum校验，
+	// 其余block在打开table时总是会校验
+	SkipChecksumVerification bool
+	// GlobalVersion 不为0时，OpenReader打开的table中所有key的版本都视为这个值，
+	// 用于外部导入的table，文件中key的版本必须都是0
+	GlobalVersion uint64
+	// FilterMetrics 不为nil时记录过滤器的效果
+	FilterMetrics *bloomfilter.FilterMetrics
+	// FilterMetricsSet 不为nil时TableCache打开的每个table使用ForTable(level, id)的统计，
+	// 代替所有table共享的FilterMetrics
+	FilterMetricsSet *bloomfilter.MetricsSet
+	// BlockCache 多个table共享的block cache，为nil时index和filter常驻内存，
+	// data block每次从文件读取
+	BlockCache *BlockCache
+	// PinL0FilterAndIndexBlocks L0的table的index和filter block常驻内存，
+	// 仍然计入BlockCache的用量
+	PinL0FilterAndIndexBlocks bool
+}
+
+func DefaultOptions() Options {
+	return Options{
+		FS:                   vfs.Default,
+		BlockSize:            4 << 10,
+		BlockRestartInterval: defaultRestartInterval,
+		Compression:          SnappyCompression,
+		FilterPolicy:         bloomfilter.NewBloomFilterPoliy(10),
+		ReadaheadSize:        8 << 10,
+		MaxReadaheadSize:     256 << 10,
+	}
+}
+
+// FileSystem 返回读写table文件使用的文件系统
+func (o *Options) FileSystem() vfs.FS {
+	if o.FS == nil {
+		return vfs.Default
+	}
+	return o.FS
+}
+
+// FormatForLevel 返回level上的table使用的格式
+func (o *Options) FormatForLevel(level int) TableFormat {
+	if len(o.LevelFormat) == 0 {
+		return o.Format
+	}
+	if level < len(o.LevelFormat) {
+		return o.LevelFormat[level]
+	}
+	return o.LevelFormat[len(o.LevelFormat)-1]
+}
+
+// CompressionForLevel 返回level上的table使用的压缩算法
+func (o *Options) CompressionForLevel(level int) CompressionType {
+	if len(o.LevelCompression) == 0 {
+		return o.Compression
+	}
+	if level < len(o.LevelCompression) {
+		return o.LevelCompression[level]
+	}
+	return o.LevelCompression[len(o.LevelCompression)-1]
+}
+
+// encodedValue 写入table时的value，ValueChecksums时加上x.BitChecksum
+func (o Options) encodedValue(v x.ValueStruct) x.ValueStruct {
+	if o.ValueChecksums {
+		v.Meta |= x.BitChecksum
+	}
+	return v
+}
@@ -0,0 +1,224 @@
+package table
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/YzmjY/toykv/bloomfilter"
+	"github.com/YzmjY/toykv/x"
+)
+
+// plain table的格式，整个文件映射到内存中读取，不分block、不压缩、不做校验：
+//
+//	| record 0 | ... | record n-1 | hash index | samples | properties | footer |
+//
+// record按内部key有序：
+//
+//	| keyLen(uvarint) | key | valueLen(uvarint) | value(x.ValueStruct.Encode) |
+//
+// hash index：numBuckets个uint64，线性探测的hash表，把userKey映射到它第一个版本所在的
+// record，保存的是record的偏移+1，0表示空。点查只需要一次hash探测和一次key比较。
+// samples：每plainSampleInterval个record的偏移(uint64)，用于迭代器的Seek和反向迭代。
+// properties与block格式的properties block相同，没有trailer。
+// footer定长，位于文件末尾：
+//
+//	| hash offset | numBuckets | samples offset | numSamples | properties offset | properties size | version(uint32) | magic(uint64) |
+
+const (
+	plainTableMagic   uint64 = 0x746f796b762e7074 // "toykv.pt"
+	plainTableVersion uint32 = 1
+
+	plainFooterSize = 6*8 + 4 + 8
+
+	plainSampleInterval = 16
+	// hash表的装填因子
+	plainHashUtilRatio = 0.75
+)
+
+var errBadPlainTable = errors.New("table: bad plain table")
+
+type plainFooter struct {
+	hashOffset   uint64
+	numBuckets   uint64
+	sampleOffset uint64
+	numSamples   uint64
+	props        blockHandle
+}
+
+func (f plainFooter) encode(dst []byte) []byte {
+	dst = binary.LittleEndian.AppendUint64(dst, f.hashOffset)
+	dst = binary.LittleEndian.AppendUint64(dst, f.numBuckets)
+	dst = binary.LittleEndian.AppendUint64(dst, f.sampleOffset)
+	dst = binary.LittleEndian.AppendUint64(dst, f.numSamples)
+	dst = binary.LittleEndian.AppendUint64(dst, f.props.offset)
+	dst = binary.LittleEndian.AppendUint64(dst, f.props.size)
+	dst = binary.LittleEndian.AppendUint32(dst, plainTableVersion)
+	dst = binary.LittleEndian.AppendUint64(dst, plainTableMagic)
+	return dst
+}
+
+// decodePlainFooter 解析footer并检查各部分是否在文件范围内
+func decodePlainFooter(src []byte, fileSize uint64) (plainFooter, error) {
+	var f plainFooter
+	if len(src) != plainFooterSize || binary.LittleEndian.Uint64(src[52:]) != plainTableMagic {
+		return f, errBadMagic
+	}
+	if v := binary.LittleEndian.Uint32(src[48:]); v != plainTableVersion {
+		return f, fmt.Errorf("%w: %d", errBadVersion, v)
+	}
+
+	f.hashOffset = binary.LittleEndian.Uint64(src[0:])
+	f.numBuckets = binary.LittleEndian.Uint64(src[8:])
+	f.sampleOffset = binary.LittleEndian.Uint64(src[16:])
+	f.numSamples = binary.LittleEndian.Uint64(src[24:])
+	f.props.offset = binary.LittleEndian.Uint64(src[32:])
+	f.props.size = binary.LittleEndian.Uint64(src[40:])
+
+	// 各部分依次排列，不能重叠或超出文件
+	end := fileSize - plainFooterSize
+	if f.numBuckets == 0 || f.numBuckets > end/8 || f.numSamples > end/8 ||
+		f.hashOffset > end || f.sampleOffset != f.hashOffset+f.numBuckets*8 ||
+		f.props.offset != f.sampleOffset+f.numSamples*8 || f.props.offset > end ||
+		f.props.size != end-f.props.offset {
+		return f, errBadPlainTable
+	}
+	return f, nil
+}
+
+type plainHashEntry struct {
+	hash   uint32
+	offset uint64
+}
+
+// PlainTableBuilder 构造plain格式的table
+type PlainTableBuilder struct {
+	opts Options
+	w    io.Writer
+
+	offset  uint64
+	lastKey []byte
+	entries []plainHashEntry // 每个userKey第一个版本的位置
+	samples []uint64
+
+	props      Properties
+	collectors propertiesCollectors
+
+	err error
+}
+
+func NewPlainTableBuilder(w io.Writer, opts Options) *PlainTableBuilder {
+	return &PlainTableBuilder{
+		opts:       opts,
+		w:          w,
+		collectors: newPropertiesCollectors(opts),
+	}
+}
+
+// Add 添加一个kv，key为带时间戳的内部key，需要严格递增
+func (b *PlainTableBuilder) Add(key []byte, v x.ValueStruct) error {
+	if b.err != nil {
+		return b.err
+	}
+	if b.err = checkKeyOrder(b.lastKey, key); b.err != nil {
+		return b.err
+	}
+
+	if len(b.lastKey) == 0 || !x.SameUserKey(b.lastKey, key) {
+		b.entries = append(b.entries, plainHashEntry{
+			hash:   bloomfilter.Hash(x.ParseUserKey(key)),
+			offset: b.offset,
+		})
+	}
+	if b.props.NumEntries%plainSampleInterval == 0 {
+		b.samples = append(b.samples, b.offset)
+	}
+
+	b.props.add(key, v)
+	if b.err = b.collectors.add(key, v); b.err != nil {
+		return b.err
+	}
+	b.lastKey = append(b.lastKey[:0], key...)
+
+	ev := b.opts.encodedValue(v)
+	vs := make([]byte, ev.EncodeSize())
+	ev.Encode(vs)
+	var buf []byte
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	buf = append(buf, key...)
+	buf = binary.AppendUvarint(buf, uint64(len(vs)))
+	buf = append(buf, vs...)
+	b.write(buf)
+	return b.err
+}
+
+func (b *PlainTableBuilder) write(data []byte) {
+	if b.err != nil {
+		return
+	}
+	if _, err := b.w.Write(data); err != nil {
+		b.err = err
+		return
+	}
+	b.offset += uint64(len(data))
+}
+
+// Empty 是否还没有添加任何kv
+func (b *PlainTableBuilder) Empty() bool {
+	return b.props.NumEntries == 0
+}
+
+func (b *PlainTableBuilder) numBuckets() int {
+	return int(float64(len(b.entries))/plainHashUtilRatio) + 1
+}
+
+// EstimatedSize 如果此时调用Finish，table文件大约的大小
+func (b *PlainTableBuilder) EstimatedSize() uint64 {
+	return b.offset + uint64(b.numBuckets()+len(b.samples))*8 + plainFooterSize
+}
+
+// Finish 写入hash index、samples、properties以及footer
+func (b *PlainTableBuilder) Finish() error {
+	if b.err != nil {
+		return b.err
+	}
+	b.props.Biggest = append([]byte(nil), b.lastKey...)
+	b.props.RawDataSize = b.offset
+	b.props.DataSize = b.offset
+
+	f := plainFooter{
+		hashOffset: b.offset,
+		numBuckets: uint64(b.numBuckets()),
+		numSamples: uint64(len(b.samples)),
+	}
+	buckets := make([]uint64, f.numBuckets)
+	for _, e := range b.entries {
+		i := uint64(e.hash) % f.numBuckets
+		for buckets[i] != 0 {
+			i = (i + 1) % f.numBuckets
+		}
+		buckets[i] = e.offset + 1
+	}
+
+	var buf []byte
+	for _, v := range buckets {
+		buf = binary.LittleEndian.AppendUint64(buf, v)
+	}
+	for _, v := range b.samples {
+		buf = binary.LittleEndian.AppendUint64(buf, v)
+	}
+	b.props.IndexSize = uint64(len(buf))
+	b.write(buf)
+	f.sampleOffset = f.hashOffset + f.numBuckets*8
+
+	if err := b.collectors.finish(&b.props); err != nil {
+		return err
+	}
+	props := b.props.encode()
+	f.props = blockHandle{offset: b.offset, size: uint64(len(props))}
+	b.write(props)
+	b.write(f.encode(nil))
+
+	return b.err
+}
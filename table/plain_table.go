@@ -0,0 +1,442 @@
+package table
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"github.com/YzmjY/toykv/bloomfilter"
+	"github.com/YzmjY/toykv/x"
+)
+
+// PlainTable 只读的plain格式table，整个文件映射到内存中
+type PlainTable struct {
+	path string
+	file fileReader
+
+	footer  plainFooter
+	records []byte
+	buckets []byte
+	samples []byte
+	props   Properties
+
+	ref    atomic.Int32
+	closed atomic.Bool
+}
+
+// OpenPlainTable 打开plain格式的table，总是使用mmap，忽略opts.LoadingMode
+func OpenPlainTable(path string, opts Options) (*PlainTable, error) {
+	file, err := openFileReader(opts.FileSystem(), path, LoadingModeMmap, false)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &PlainTable{path: path, file: file}
+	t.ref.Store(1)
+	if err := t.load(); err != nil {
+		file.close()
+		return nil, fmt.Errorf("table: open %s: %w", path, err)
+	}
+	return t, nil
+}
+
+func (t *PlainTable) load() error {
+	size := t.file.size()
+	if size < plainFooterSize {
+		return t.corruption(0, BlockTypeFooter, errBadMagic)
+	}
+	data, err := t.file.readAt(0, size)
+	if err != nil {
+		return err
+	}
+
+	footerOffset := size - plainFooterSize
+	if t.footer, err = decodePlainFooter(data[footerOffset:], size); err != nil {
+		return t.corruption(footerOffset, BlockTypeFooter, err)
+	}
+	f := t.footer
+	t.records = data[:f.hashOffset]
+	t.buckets = data[f.hashOffset:f.sampleOffset]
+	t.samples = data[f.sampleOffset:f.props.offset]
+
+	if t.props, err = decodeProperties(data[f.props.offset:footerOffset]); err != nil {
+		return t.corruption(f.props.offset, BlockTypeProperties, err)
+	}
+	return nil
+}
+
+func (t *PlainTable) corruption(offset uint64, typ BlockType, err error) error {
+	return &CorruptionError{
+		File:      t.path,
+		Offset:    offset,
+		BlockType: typ,
+		Err:       err,
+	}
+}
+
+// record 解析offset处的record，返回下一个record的偏移
+func (t *PlainTable) record(offset int) (key, value []byte, next int, err error) {
+	p := t.records[offset:]
+	keyLen, n1 := binary.Uvarint(p)
+	if n1 <= 0 || uint64(len(p)-n1) < keyLen {
+		return nil, nil, 0, t.corruption(uint64(offset), BlockTypeRecord, errBadPlainTable)
+	}
+	key = p[n1 : n1+int(keyLen)]
+	if _, err := x.ParseInternalKey(key); err != nil {
+		return nil, nil, 0, t.corruption(uint64(offset), BlockTypeRecord, err)
+	}
+	p = p[n1+int(keyLen):]
+
+	valueLen, n2 := binary.Uvarint(p)
+	if n2 <= 0 || uint64(len(p)-n2) < valueLen {
+		return nil, nil, 0, t.corruption(uint64(offset), BlockTypeRecord, errBadPlainTable)
+	}
+	value = p[n2 : n2+int(valueLen)]
+	var vs x.ValueStruct
+	if err := vs.DecodeChecked(value); err != nil {
+		return nil, nil, 0, t.corruption(uint64(offset), BlockTypeRecord, err)
+	}
+	return key, value, offset + n1 + int(keyLen) + n2 + int(valueLen), nil
+}
+
+// findUserKey 在hash index中查找key的userKey第一个版本所在的record，不存在时返回-1
+func (t *PlainTable) findUserKey(key []byte) (int, error) {
+	n := t.footer.numBuckets
+	i := uint64(bloomfilter.Hash(x.ParseUserKey(key))) % n
+	for probes := uint64(0); probes < n; probes++ {
+		slot := binary.LittleEndian.Uint64(t.buckets[i*8:])
+		if slot == 0 {
+			return -1, nil
+		}
+		if slot > uint64(len(t.records)) {
+			return -1, t.corruption(t.footer.hashOffset+i*8, BlockTypeIndex, errBadPlainTable)
+		}
+
+		offset := int(slot - 1)
+		k, _, _, err := t.record(offset)
+		if err != nil {
+			return -1, err
+		}
+		if x.SameUserKey(k, key) {
+			return offset, nil
+		}
+		i = (i + 1) % n
+	}
+	return -1, nil
+}
+
+// Get 查找userKey相同、版本不大于key中版本的最新的值，不存在时返回空的ValueStruct。
+// key不是合法的内部key时返回x.ErrBadInternalKey
+func (t *PlainTable) Get(key []byte) (x.ValueStruct, error) {
+	if _, err := x.ParseInternalKey(key); err != nil {
+		return x.ValueStruct{}, err
+	}
+	offset, err := t.findUserKey(key)
+	if err != nil || offset < 0 {
+		return x.ValueStruct{}, err
+	}
+
+	// 同一个userKey的版本从新到旧排列，找到第一个不大于查询版本的
+	for offset < len(t.records) {
+		k, v, next, err := t.record(offset)
+		if err != nil {
+			return x.ValueStruct{}, err
+		}
+		if !x.SameUserKey(k, key) {
+			break
+		}
+		if x.KeysCompare(k, key) >= 0 {
+			var vs x.ValueStruct
+			vs.Decode(v)
+			vs.Version = x.ParseTs(k)
+			return vs, nil
+		}
+		offset = next
+	}
+	return x.ValueStruct{}, nil
+}
+
+func (t *PlainTable) numSamples() int {
+	return int(t.footer.numSamples)
+}
+
+// sample 第idx个采样的record的偏移
+func (t *PlainTable) sample(idx int) int {
+	return int(binary.LittleEndian.Uint64(t.samples[idx*8:]))
+}
+
+func (t *PlainTable) Path() string {
+	return t.path
+}
+
+// Size table文件的大小
+func (t *PlainTable) Size() uint64 {
+	return t.file.size()
+}
+
+// Smallest 最小的key
+func (t *PlainTable) Smallest() []byte {
+	return t.props.Smallest
+}
+
+// Biggest 最大的key
+func (t *PlainTable) Biggest() []byte {
+	return t.props.Biggest
+}
+
+// KeyCount table中kv的个数
+func (t *PlainTable) KeyCount() uint64 {
+	return t.props.NumEntries
+}
+
+// MaxVersion table中所有key的最大版本
+func (t *PlainTable) MaxVersion() uint64 {
+	return t.props.MaxVersion
+}
+
+// Properties 构造table时统计的属性
+func (t *PlainTable) Properties() *Properties {
+	return &t.props
+}
+
+// RangeDeletions plain格式不支持范围删除
+func (t *PlainTable) RangeDeletions() []RangeTombstone {
+	return nil
+}
+
+func (t *PlainTable) IncrRef() {
+	t.ref.Add(1)
+}
+
+// DecrRef 引用计数减为0时关闭文件
+func (t *PlainTable) DecrRef() {
+	_ = t.decrRef()
+}
+
+func (t *PlainTable) decrRef() error {
+	new := t.ref.Add(-1)
+	if new > 0 {
+		// still alive
+		return nil
+	}
+	if new < 0 {
+		return errRefUnderflow
+	}
+	return t.file.close()
+}
+
+// Close 释放打开时持有的引用，重复调用直接返回nil
+func (t *PlainTable) Close() error {
+	if t.closed.Swap(true) {
+		return nil
+	}
+	return t.decrRef()
+}
+
+// PlainTableIterator plain table上的迭代器，reversed表示迭代方向，与skiplist.UniIterator一致
+type PlainTableIterator struct {
+	t        *PlainTable
+	reversed bool
+
+	offset int // 当前record的偏移，等于len(t.records)表示无效
+	next   int
+	key    []byte
+	val    []byte
+
+	err error
+}
+
+// NewIterator 迭代器持有table的引用，用完后必须调用Close
+func (t *PlainTable) NewIterator(reversed bool) TableIterator {
+	t.IncrRef()
+	return &PlainTableIterator{
+		t:        t,
+		reversed: reversed,
+		offset:   len(t.records),
+		next:     len(t.records),
+	}
+}
+
+func (it *PlainTableIterator) Error() error {
+	return it.err
+}
+
+func (it *PlainTableIterator) Vaild() bool {
+	return it.err == nil && it.offset < len(it.t.records)
+}
+
+func (it *PlainTableIterator) Key() []byte {
+	return it.key
+}
+
+func (it *PlainTableIterator) Value() (ret x.ValueStruct) {
+	ret.Decode(it.val)
+	return
+}
+
+func (it *PlainTableIterator) invalidate() {
+	it.offset = len(it.t.records)
+	it.next = len(it.t.records)
+}
+
+// parse 解析offset处的record
+func (it *PlainTableIterator) parse(offset int) bool {
+	if offset >= len(it.t.records) {
+		it.invalidate()
+		return false
+	}
+	key, val, next, err := it.t.record(offset)
+	if err != nil {
+		it.err = err
+		it.invalidate()
+		return false
+	}
+	it.offset, it.next, it.key, it.val = offset, next, key, val
+	return true
+}
+
+// sampleOffset 第idx个采样点的偏移，超出records时报告损坏
+func (it *PlainTableIterator) sampleOffset(idx int) (int, bool) {
+	off := it.t.sample(idx)
+	if off < 0 || off >= len(it.t.records) {
+		it.err = it.t.corruption(it.t.footer.sampleOffset+uint64(idx)*8, BlockTypeIndex, errBadPlainTable)
+		it.invalidate()
+		return 0, false
+	}
+	return off, true
+}
+
+func (it *PlainTableIterator) seekToFirst() {
+	it.parse(0)
+}
+
+func (it *PlainTableIterator) seekToLast() {
+	n := it.t.numSamples()
+	if n == 0 {
+		it.invalidate()
+		return
+	}
+	off, ok := it.sampleOffset(n - 1)
+	if !ok {
+		return
+	}
+	for it.parse(off) && it.next < len(it.t.records) {
+		off = it.next
+	}
+}
+
+// seek 移动到第一个大于等于key的位置
+func (it *PlainTableIterator) seek(key []byte) {
+	// 找到最后一个key小于目标key的采样点
+	var failed bool
+	idx := sort.Search(it.t.numSamples(), func(i int) bool {
+		off, ok := it.sampleOffset(i)
+		if !ok {
+			failed = true
+			return true
+		}
+		k, _, _, err := it.t.record(off)
+		if err != nil {
+			it.err = err
+			failed = true
+			return true
+		}
+		return x.KeysCompare(k, key) >= 0
+	})
+	if failed {
+		it.invalidate()
+		return
+	}
+	if idx > 0 {
+		idx--
+	}
+
+	off := 0
+	if it.t.numSamples() > 0 {
+		var ok bool
+		if off, ok = it.sampleOffset(idx); !ok {
+			return
+		}
+	}
+	for it.parse(off) {
+		if x.KeysCompare(it.key, key) >= 0 {
+			return
+		}
+		off = it.next
+	}
+}
+
+// seekPrev 移动到最后一个小于等于key的位置
+func (it *PlainTableIterator) seekPrev(key []byte) {
+	it.seek(key)
+	if it.err != nil {
+		return
+	}
+	if !it.Vaild() {
+		it.seekToLast()
+	} else if x.KeysCompare(it.key, key) > 0 {
+		it.prev()
+	}
+}
+
+// prev record无法反向解析，从前一个采样点开始向后扫描
+func (it *PlainTableIterator) prev() {
+	cur := it.offset
+	idx := sort.Search(it.t.numSamples(), func(i int) bool {
+		return it.t.sample(i) >= cur
+	}) - 1
+	if idx < 0 {
+		// 已经是第一个record
+		it.invalidate()
+		return
+	}
+
+	off, ok := it.sampleOffset(idx)
+	if !ok {
+		return
+	}
+	for it.parse(off) && it.next < cur {
+		off = it.next
+	}
+}
+
+func (it *PlainTableIterator) Rewind() {
+	it.err = nil
+	if it.reversed {
+		it.seekToLast()
+	} else {
+		it.seekToFirst()
+	}
+}
+
+// Seek 正向时移动到第一个大于等于key的位置，反向时移动到最后一个小于等于key的位置
+func (it *PlainTableIterator) Seek(key []byte) {
+	if _, it.err = x.ParseInternalKey(key); it.err != nil {
+		return
+	}
+	if it.reversed {
+		it.seekPrev(key)
+	} else {
+		it.seek(key)
+	}
+}
+
+func (it *PlainTableIterator) Next() {
+	if !it.Vaild() {
+		return
+	}
+	if it.reversed {
+		it.prev()
+	} else {
+		it.parse(it.next)
+	}
+}
+
+func (it *PlainTableIterator) Close() {
+	if it.t == nil {
+		return
+	}
+	it.t.DecrRef()
+	it.t = nil
+}
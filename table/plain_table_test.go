@@ -0,0 +1,240 @@
+package table
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/YzmjY/toykv/x"
+	"github.com/stretchr/testify/require"
+)
+
+func plainOptions() Options {
+	opts := DefaultOptions()
+	opts.LevelFormat = []TableFormat{BlockBasedFormat, PlainFormat}
+	opts.Level = 1
+	return opts
+}
+
+func TestPlainTableGet(t *testing.T) {
+	const n = 10000
+	opts := plainOptions()
+	r, err := OpenReader(buildTestTable(t, n, opts), opts)
+	require.NoError(t, err)
+	defer r.Close()
+	require.IsType(t, &PlainTable{}, r)
+
+	require.EqualValues(t, n, r.KeyCount())
+	require.EqualValues(t, 7, r.MaxVersion())
+	require.Equal(t, tableKey(0), r.Smallest())
+	require.Equal(t, tableKey(n-1), r.Biggest())
+
+	for i := 0; i < n; i++ {
+		v, err := r.Get(x.KeyWithTs([]byte(fmt.Sprintf("key%06d", i)), 10))
+		require.NoError(t, err)
+		require.Equal(t, tableValue(i).Value, v.Value)
+		require.Equal(t, tableValue(i).Meta, v.Meta)
+		require.EqualValues(t, i%7+1, v.Version)
+
+		v, err = r.Get(x.KeyWithTs([]byte(fmt.Sprintf("key%06d_", i)), 10))
+		require.NoError(t, err)
+		require.Nil(t, v.Value)
+	}
+
+	// 版本更小的查询看不到
+	v, err := r.Get(x.KeyWithTs([]byte("key000006"), 1))
+	require.NoError(t, err)
+	require.Nil(t, v.Value)
+}
+
+func TestPlainTableVersions(t *testing.T) {
+	opts := plainOptions()
+	path := filepath.Join(t.TempDir(), "000001.sst")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	b := NewTableBuilder(f, opts)
+	require.IsType(t, &PlainTableBuilder{}, b)
+	for i := 0; i < 100; i++ {
+		for ts := 50; ts >= 10; ts -= 10 {
+			key := x.KeyWithTs([]byte(fmt.Sprintf("k%03d", i)), uint64(ts))
+			require.NoError(t, b.Add(key, x.ValueStruct{Value: []byte(fmt.Sprint(i, "@", ts))}))
+		}
+	}
+	require.NoError(t, b.Finish())
+	require.NoError(t, f.Close())
+
+	r, err := OpenReader(path, opts)
+	require.NoError(t, err)
+	defer r.Close()
+	for i := 0; i < 100; i++ {
+		for ts := 5; ts <= 60; ts += 5 {
+			v, err := r.Get(x.KeyWithTs([]byte(fmt.Sprintf("k%03d", i)), uint64(ts)))
+			require.NoError(t, err)
+			if ts < 10 {
+				require.Nil(t, v.Value)
+				continue
+			}
+			want := ts / 10 * 10
+			if want > 50 {
+				want = 50
+			}
+			require.Equal(t, fmt.Sprint(i, "@", want), string(v.Value))
+		}
+	}
+}
+
+func TestPlainTableIterator(t *testing.T) {
+	const n = 1000
+	opts := plainOptions()
+	plain, err := OpenReader(buildTestTable(t, n, opts), opts)
+	require.NoError(t, err)
+	defer plain.Close()
+
+	// 与block格式的迭代器行为保持一致
+	opts.Level = 0
+	blockBased, err := OpenReader(buildTestTable(t, n, opts), opts)
+	require.NoError(t, err)
+	defer blockBased.Close()
+	require.IsType(t, &Table{}, blockBased)
+
+	seekKeys := [][]byte{
+		x.KeyWithTs([]byte("a"), 0),
+		x.KeyWithTs([]byte("z"), 0),
+	}
+	for i := 0; i < n; i += 7 {
+		seekKeys = append(seekKeys,
+			tableKey(i),
+			x.KeyWithTs([]byte(fmt.Sprintf("key%06d", i)), 100),
+			x.KeyWithTs([]byte(fmt.Sprintf("key%06d", i)), 0),
+			x.KeyWithTs([]byte(fmt.Sprintf("key%06d_", i)), 0),
+		)
+	}
+
+	for _, reversed := range []bool{false, true} {
+		it := plain.NewIterator(reversed)
+		bit := blockBased.NewIterator(reversed)
+
+		cnt := 0
+		for it.Rewind(); it.Vaild(); it.Next() {
+			cnt++
+		}
+		require.NoError(t, it.Error())
+		require.Equal(t, n, cnt)
+
+		for _, key := range seekKeys {
+			it.Seek(key)
+			bit.Seek(key)
+			require.Equal(t, bit.Vaild(), it.Vaild(), "reversed=%v key=%q", reversed, key)
+			for step := 0; step < 20 && bit.Vaild(); step++ {
+				require.True(t, it.Vaild())
+				require.Equal(t, bit.Key(), it.Key())
+				require.Equal(t, bit.Value().Value, it.Value().Value)
+				it.Next()
+				bit.Next()
+			}
+		}
+		require.NoError(t, it.Error())
+		it.Close()
+		bit.Close()
+	}
+}
+
+func TestPlainTableEmpty(t *testing.T) {
+	opts := plainOptions()
+	r, err := OpenReader(buildTestTable(t, 0, opts), opts)
+	require.NoError(t, err)
+	defer r.Close()
+
+	v, err := r.Get(tableKey(0))
+	require.NoError(t, err)
+	require.Nil(t, v.Value)
+	for _, reversed := range []bool{false, true} {
+		it := r.NewIterator(reversed)
+		it.Rewind()
+		require.False(t, it.Vaild())
+		it.Seek(tableKey(0))
+		require.False(t, it.Vaild())
+		require.NoError(t, it.Error())
+		it.Close()
+	}
+}
+
+func TestPlainTableCorruption(t *testing.T) {
+	opts := plainOptions()
+	path := buildTestTable(t, 100, opts)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// footer中的hash offset超出文件
+	bad := append([]byte(nil), data...)
+	bad[len(bad)-plainFooterSize] ^= 0xff
+	require.NoError(t, os.WriteFile(path, bad, 0644))
+	_, err = OpenReader(path, opts)
+	var cerr *CorruptionError
+	require.ErrorAs(t, err, &cerr)
+	require.Equal(t, BlockTypeFooter, cerr.BlockType)
+
+	// 第一个record的keyLen损坏
+	bad = append([]byte(nil), data...)
+	bad[0] = 3
+	require.NoError(t, os.WriteFile(path, bad, 0644))
+	r, err := OpenReader(path, opts)
+	require.NoError(t, err)
+	defer r.Close()
+	it := r.NewIterator(false)
+	defer it.Close()
+	it.Rewind()
+	require.False(t, it.Vaild())
+	require.ErrorIs(t, it.Error(), ErrCorruption)
+}
+
+func TestTableCacheMixedFormats(t *testing.T) {
+	dir := t.TempDir()
+	opts := plainOptions()
+	require.NoError(t, os.Rename(buildTestTable(t, 100, opts), TableFileName(dir, 1)))
+	opts.Level = 0
+	require.NoError(t, os.Rename(buildTestTable(t, 100, opts), TableFileName(dir, 2)))
+
+	c := NewTableCache(dir, 2, opts)
+	defer c.Close()
+	for id, want := range map[uint64]any{1: &PlainTable{}, 2: &Table{}} {
+		r, err := c.Get(id, 0, 0)
+		require.NoError(t, err)
+		require.IsType(t, want, r)
+		v, err := r.Get(tableKey(10))
+		require.NoError(t, err)
+		require.Equal(t, tableValue(10).Value, v.Value)
+		r.DecrRef()
+	}
+}
+
+func TestPlainTableBuilderKeyOrder(t *testing.T) {
+	b := NewPlainTableBuilder(&bytes.Buffer{}, plainOptions())
+	require.NoError(t, b.Add(tableKey(1), tableValue(1)))
+	require.ErrorIs(t, b.Add(tableKey(0), tableValue(0)), ErrKeyOrder)
+	require.ErrorIs(t, b.Add(tableKey(2), tableValue(2)), ErrKeyOrder)
+	require.ErrorIs(t, b.Finish(), ErrKeyOrder)
+
+	b = NewPlainTableBuilder(&bytes.Buffer{}, plainOptions())
+	require.ErrorIs(t, b.Add([]byte("k"), tableValue(0)), ErrKeyTooShort)
+}
+
+func TestPlainTableCloseTwice(t *testing.T) {
+	opts := plainOptions()
+	r, err := OpenReader(buildTestTable(t, 100, opts), opts)
+	require.NoError(t, err)
+	tbl := r.(*PlainTable)
+
+	it := tbl.NewIterator(false)
+	it.Rewind()
+	require.NoError(t, tbl.Close())
+	require.NoError(t, tbl.Close())
+	require.True(t, it.Vaild())
+	require.Equal(t, tableKey(0), it.Key())
+	it.Close()
+	it.Close()
+
+	require.ErrorIs(t, tbl.decrRef(), errRefUnderflow)
+}
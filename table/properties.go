@@ -0,0 +1,267 @@
+package table
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/YzmjY/toykv/x"
+)
+
+// properties block与metaindex格式相同，key为属性名，value为属性值，
+// 整数用uvarint保存。toykv自己的属性以"toykv."开头，其余的属性来自TablePropertiesCollector
+
+const propertyPrefix = "toykv."
+
+const (
+	propSmallest      = "toykv.smallest"
+	propBiggest       = "toykv.biggest"
+	propNumEntries    = "toykv.num_entries"
+	propNumTombstones = "toykv.num_tombstones"
+	propRawKeySize    = "toykv.raw_key_size"
+	propRawValueSize  = "toykv.raw_value_size"
+	propNumDataBlocks = "toykv.num_data_blocks"
+	propRawDataSize   = "toykv.raw_data_size"
+	propDataSize      = "toykv.data_size"
+	propIndexSize     = "toykv.index_size"
+	propFilterSize    = "toykv.filter_size"
+	propMinVersion    = "toykv.min_version"
+	propMaxVersion    = "toykv.max_version"
+	propMinExpiresAt  = "toykv.min_expires_at"
+	propMaxExpiresAt  = "toykv.max_expires_at"
+	propFilterPolicy  = "toykv.filter_policy"
+
+	propNumRangeDeletions = "toykv.num_range_deletions"
+)
+
+var (
+	errBadProperties = errors.New("table: bad properties block")
+	// ErrReservedProperty 用户属性名不能以"toykv."开头
+	ErrReservedProperty = errors.New("table: property name uses the reserved prefix " + propertyPrefix)
+)
+
+// Properties table的属性，构造table时统计，不需要扫描数据就可以得到
+type Properties struct {
+	Smallest []byte
+	Biggest  []byte
+
+	NumEntries    uint64
+	NumTombstones uint64 // 删除类型的key或者带有x.BitDelete的kv个数
+	// NumRangeDeletions 范围删除的个数，不计入NumEntries
+	NumRangeDeletions uint64
+
+	RawKeySize    uint64
+	RawValueSize  uint64 // ValueStruct编码后的大小
+	NumDataBlocks uint64
+	RawDataSize   uint64 // data block压缩前的大小
+	DataSize      uint64 // data block写入文件的大小，不包括trailer
+	IndexSize     uint64
+	FilterSize    uint64
+
+	MinVersion uint64
+	MaxVersion uint64
+	// 只统计设置了过期时间的kv，都没有设置时为0
+	MinExpiresAt uint64
+	MaxExpiresAt uint64
+
+	// FilterPolicy 没有过滤器时为空
+	FilterPolicy string
+
+	// UserCollected TablePropertiesCollector收集的属性
+	UserCollected map[string][]byte
+}
+
+// TablePropertiesCollector 构造table时收集自定义的属性，
+// 每个Builder通过Options.PropertiesCollectors创建自己的collector
+type TablePropertiesCollector interface {
+	Name() string
+	// Add 每添加一个kv调用一次
+	Add(key []byte, v x.ValueStruct) error
+	// Finish 返回要保存的属性，属性名不能以"toykv."开头
+	Finish() (map[string][]byte, error)
+}
+
+type propertiesCollectors []TablePropertiesCollector
+
+func newPropertiesCollectors(opts Options) propertiesCollectors {
+	var cs propertiesCollectors
+	for _, newCollector := range opts.PropertiesCollectors {
+		cs = append(cs, newCollector())
+	}
+	return cs
+}
+
+func (cs propertiesCollectors) add(key []byte, v x.ValueStruct) error {
+	for _, c := range cs {
+		if err := c.Add(key, v); err != nil {
+			return fmt.Errorf("table: properties collector %s: %w", c.Name(), err)
+		}
+	}
+	return nil
+}
+
+// finish 把collector收集的属性合并到p中
+func (cs propertiesCollectors) finish(p *Properties) error {
+	for _, c := range cs {
+		props, err := c.Finish()
+		if err != nil {
+			return fmt.Errorf("table: properties collector %s: %w", c.Name(), err)
+		}
+		for name, v := range props {
+			if strings.HasPrefix(name, propertyPrefix) {
+				return fmt.Errorf("%w: collector %s: %q", ErrReservedProperty, c.Name(), name)
+			}
+			if p.UserCollected == nil {
+				p.UserCollected = make(map[string][]byte)
+			}
+			p.UserCollected[name] = v
+		}
+	}
+	return nil
+}
+
+func (p *Properties) add(key []byte, v x.ValueStruct) {
+	if p.NumEntries == 0 {
+		p.Smallest = append([]byte(nil), key...)
+		p.MinVersion = math.MaxUint64
+	}
+	p.NumEntries++
+	switch typ := x.ParseValueType(key); {
+	case typ == x.ValueTypeDelete || typ == x.ValueTypeSingleDelete:
+		p.NumTombstones++
+	case v.Meta&x.BitDelete != 0:
+		// 旧的写入方只在Meta中标记删除
+		p.NumTombstones++
+	}
+	p.RawKeySize += uint64(len(key))
+	p.RawValueSize += uint64(v.EncodeSize())
+
+	version := x.ParseTs(key)
+	if version < p.MinVersion {
+		p.MinVersion = version
+	}
+	if version > p.MaxVersion {
+		p.MaxVersion = version
+	}
+	if v.ExpiresAt != 0 {
+		if p.MinExpiresAt == 0 || v.ExpiresAt < p.MinExpiresAt {
+			p.MinExpiresAt = v.ExpiresAt
+		}
+		if v.ExpiresAt > p.MaxExpiresAt {
+			p.MaxExpiresAt = v.ExpiresAt
+		}
+	}
+}
+
+func (p *Properties) encode() []byte {
+	props := map[string][]byte{
+		propSmallest: p.Smallest,
+		propBiggest:  p.Biggest,
+	}
+	for name, v := range map[string]uint64{
+		propNumEntries:        p.NumEntries,
+		propNumTombstones:     p.NumTombstones,
+		propNumRangeDeletions: p.NumRangeDeletions,
+		propRawKeySize:        p.RawKeySize,
+		propRawValueSize:      p.RawValueSize,
+		propNumDataBlocks:     p.NumDataBlocks,
+		propRawDataSize:       p.RawDataSize,
+		propDataSize:          p.DataSize,
+		propIndexSize:         p.IndexSize,
+		propFilterSize:        p.FilterSize,
+		propMinVersion:        p.MinVersion,
+		propMaxVersion:        p.MaxVersion,
+		propMinExpiresAt:      p.MinExpiresAt,
+		propMaxExpiresAt:      p.MaxExpiresAt,
+	} {
+		props[name] = binary.AppendUvarint(nil, v)
+	}
+	if p.FilterPolicy != "" {
+		props[propFilterPolicy] = []byte(p.FilterPolicy)
+	}
+	// 保留前缀的用户属性已经在propertiesCollectors.finish中拒绝
+	for name, v := range p.UserCollected {
+		props[name] = v
+	}
+
+	// block中的key需要有序
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := newBlockBuilder(1)
+	for _, name := range names {
+		b.add([]byte(name), props[name])
+	}
+	return b.finish()
+}
+
+func decodeProperties(data []byte) (Properties, error) {
+	var p Properties
+	// 返回的属性引用了block中的数据，mmap模式下需要拷贝出来
+	b, err := newBlock(append([]byte(nil), data...))
+	if err != nil {
+		return p, err
+	}
+	b.minKeyLen = 0 // key为属性名
+
+	uints := map[string]*uint64{
+		propNumEntries:        &p.NumEntries,
+		propNumTombstones:     &p.NumTombstones,
+		propNumRangeDeletions: &p.NumRangeDeletions,
+		propRawKeySize:        &p.RawKeySize,
+		propRawValueSize:      &p.RawValueSize,
+		propNumDataBlocks:     &p.NumDataBlocks,
+		propRawDataSize:       &p.RawDataSize,
+		propDataSize:          &p.DataSize,
+		propIndexSize:         &p.IndexSize,
+		propFilterSize:        &p.FilterSize,
+		propMinVersion:        &p.MinVersion,
+		propMaxVersion:        &p.MaxVersion,
+		propMinExpiresAt:      &p.MinExpiresAt,
+		propMaxExpiresAt:      &p.MaxExpiresAt,
+	}
+
+	iter := b.newIterator()
+	for iter.SeekToFirst(); iter.Vaild(); iter.Next() {
+		name, value := string(iter.Key()), iter.RawValue()
+		if ptr, ok := uints[name]; ok {
+			v, n := binary.Uvarint(value)
+			if n <= 0 {
+				return p, errBadProperties
+			}
+			*ptr = v
+			continue
+		}
+
+		switch {
+		case name == propSmallest:
+			p.Smallest = value
+		case name == propBiggest:
+			p.Biggest = value
+		case name == propFilterPolicy:
+			p.FilterPolicy = string(value)
+		case strings.HasPrefix(name, propertyPrefix):
+			// 新版本增加的属性
+		default:
+			if p.UserCollected == nil {
+				p.UserCollected = make(map[string][]byte)
+			}
+			p.UserCollected[name] = value
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return p, err
+	}
+
+	// smallest和biggest会用来比较，必须是合法的内部key
+	if p.NumEntries > 0 && (len(p.Smallest) < 8 || len(p.Biggest) < 8) {
+		return p, errBadProperties
+	}
+	return p, nil
+}
@@ -0,0 +1,148 @@
+package table
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/YzmjY/toykv/x"
+	"github.com/stretchr/testify/require"
+)
+
+// countCollector 统计UserMeta为1的kv个数
+type countCollector struct {
+	n uint64
+}
+
+func (c *countCollector) Name() string {
+	return "count"
+}
+
+func (c *countCollector) Add(key []byte, v x.ValueStruct) error {
+	if v.UserMeta == 1 {
+		c.n++
+	}
+	return nil
+}
+
+func (c *countCollector) Finish() (map[string][]byte, error) {
+	return map[string][]byte{"app.user_meta_1": binary.AppendUvarint(nil, c.n)}, nil
+}
+
+type failingCollector struct{}
+
+func (failingCollector) Name() string                       { return "failing" }
+func (failingCollector) Add([]byte, x.ValueStruct) error    { return errors.New("boom") }
+func (failingCollector) Finish() (map[string][]byte, error) { return nil, nil }
+
+// reservedCollector 使用了toykv保留的属性名
+type reservedCollector struct{}
+
+func (reservedCollector) Name() string                    { return "reserved" }
+func (reservedCollector) Add([]byte, x.ValueStruct) error { return nil }
+func (reservedCollector) Finish() (map[string][]byte, error) {
+	return map[string][]byte{propNumEntries: nil}, nil
+}
+
+func TestTableProperties(t *testing.T) {
+	const n = 3000
+	opts := DefaultOptions()
+	opts.BlockSize = 512
+	opts.PropertiesCollectors = []func() TablePropertiesCollector{
+		func() TablePropertiesCollector { return &countCollector{} },
+	}
+
+	path := filepath.Join(t.TempDir(), "000001.sst")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	b := NewBuilder(f, opts)
+
+	var rawKeySize, rawValueSize uint64
+	for i := 0; i < n; i++ {
+		key := x.KeyWithTs([]byte{byte(i >> 8), byte(i)}, uint64(10+i%5))
+		v := x.ValueStruct{UserMeta: byte(i % 2), Value: bytes.Repeat([]byte("v"), i%10)}
+		if i%4 == 0 {
+			v.Meta = x.BitDelete
+		}
+		if i%3 == 0 {
+			v.ExpiresAt = uint64(1000 + i)
+		}
+		rawKeySize += uint64(len(key))
+		rawValueSize += uint64(v.EncodeSize())
+		require.NoError(t, b.Add(key, v))
+	}
+	require.NoError(t, b.Finish())
+	require.NoError(t, f.Close())
+
+	tbl, err := Open(path, opts)
+	require.NoError(t, err)
+	defer tbl.Close()
+
+	p := tbl.Properties()
+	require.EqualValues(t, n, p.NumEntries)
+	require.EqualValues(t, n/4, p.NumTombstones)
+	require.Equal(t, rawKeySize, p.RawKeySize)
+	require.Equal(t, rawValueSize, p.RawValueSize)
+	require.EqualValues(t, 10, p.MinVersion)
+	require.EqualValues(t, 14, p.MaxVersion)
+	require.EqualValues(t, 1000, p.MinExpiresAt)
+	require.EqualValues(t, 1000+n-3, p.MaxExpiresAt)
+	require.Equal(t, opts.FilterPolicy.Name(), p.FilterPolicy)
+	require.Equal(t, x.KeyWithTs([]byte{0, 0}, 10), p.Smallest)
+	require.Equal(t, tbl.Biggest(), p.Biggest)
+
+	require.Greater(t, p.NumDataBlocks, uint64(1))
+	require.Greater(t, p.RawDataSize, p.DataSize)
+	require.Greater(t, p.IndexSize, uint64(0))
+	require.Greater(t, p.FilterSize, uint64(0))
+	require.Less(t, p.DataSize+p.IndexSize+p.FilterSize, tbl.Size())
+
+	cnt, _ := binary.Uvarint(p.UserCollected["app.user_meta_1"])
+	require.EqualValues(t, n/2, cnt)
+}
+
+func TestPropertiesRoundTrip(t *testing.T) {
+	p := Properties{
+		Smallest:      x.KeyWithTs([]byte("a"), 1),
+		Biggest:       x.KeyWithTs([]byte("z"), 1),
+		NumEntries:    10,
+		NumTombstones: 2,
+		MaxVersion:    7,
+		UserCollected: map[string][]byte{"a.b": []byte("c")},
+	}
+	got, err := decodeProperties(p.encode())
+	require.NoError(t, err)
+	require.Equal(t, p, got)
+
+	// 缺少合法的smallest
+	p.Smallest = []byte("a")
+	_, err = decodeProperties(p.encode())
+	require.ErrorIs(t, err, errBadProperties)
+}
+
+func TestPropertiesCollectorError(t *testing.T) {
+	opts := DefaultOptions()
+	opts.PropertiesCollectors = []func() TablePropertiesCollector{
+		func() TablePropertiesCollector { return failingCollector{} },
+	}
+	b := NewBuilder(&bytes.Buffer{}, opts)
+	require.Error(t, b.Add(tableKey(0), tableValue(0)))
+	require.Error(t, b.Finish())
+}
+
+func TestPropertiesCollectorReservedName(t *testing.T) {
+	opts := DefaultOptions()
+	opts.PropertiesCollectors = []func() TablePropertiesCollector{
+		func() TablePropertiesCollector { return reservedCollector{} },
+	}
+	b := NewBuilder(&bytes.Buffer{}, opts)
+	require.NoError(t, b.Add(tableKey(0), tableValue(0)))
+	require.ErrorIs(t, b.Finish(), ErrReservedProperty)
+
+	pb := NewPlainTableBuilder(&bytes.Buffer{}, opts)
+	require.NoError(t, pb.Add(tableKey(0), tableValue(0)))
+	require.ErrorIs(t, pb.Finish(), ErrReservedProperty)
+}
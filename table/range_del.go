@@ -0,0 +1,77 @@
+package table
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/YzmjY/toykv/x"
+)
+
+// RangeTombstone 删除userKey在[Start, End)之间、版本不大于Version的所有key
+type RangeTombstone struct {
+	Start   []byte
+	End     []byte
+	Version uint64
+}
+
+// Deletes key是否被这个范围删除覆盖，key为带时间戳的内部key
+func (r RangeTombstone) Deletes(key []byte) bool {
+	userKey := x.ParseUserKey(key)
+	return bytes.Compare(r.Start, userKey) <= 0 && bytes.Compare(userKey, r.End) < 0 &&
+		x.ParseTs(key) <= r.Version
+}
+
+var errBadRangeDel = errors.New("table: bad range deletion")
+
+// encodeRangeDels 范围删除保存在一个单独的meta block中，
+// key为类型是x.ValueTypeRangeDelete的Start，value为End，按key排序
+func encodeRangeDels(dels []RangeTombstone) []byte {
+	keys := make([][]byte, len(dels))
+	for i, d := range dels {
+		keys[i] = x.MakeInternalKey(d.Start, d.Version, x.ValueTypeRangeDelete)
+	}
+	idx := make([]int, len(dels))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return x.KeysCompare(keys[idx[i]], keys[idx[j]]) < 0
+	})
+
+	b := newBlockBuilder(1)
+	for _, i := range idx {
+		b.add(keys[i], dels[i].End)
+	}
+	return b.finish()
+}
+
+func decodeRangeDels(data []byte) ([]RangeTombstone, error) {
+	// 返回的范围引用了block中的数据，mmap模式下需要拷贝出来
+	b, err := newBlock(append([]byte(nil), data...))
+	if err != nil {
+		return nil, err
+	}
+
+	var dels []RangeTombstone
+	iter := b.newIterator()
+	for iter.SeekToFirst(); iter.Vaild(); iter.Next() {
+		key, err := x.ParseInternalKey(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		d := RangeTombstone{
+			Start:   append([]byte(nil), key.UserKey...),
+			End:     iter.RawValue(),
+			Version: key.Version,
+		}
+		if key.Type != x.ValueTypeRangeDelete || bytes.Compare(d.Start, d.End) >= 0 {
+			return nil, errBadRangeDel
+		}
+		dels = append(dels, d)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	return dels, nil
+}
@@ -0,0 +1,87 @@
+package table
+
+// blockReader 读取文件中的一段，由fileReader和readahead实现
+type blockReader interface {
+	readAt(offset, size uint64) ([]byte, error)
+}
+
+// readaheadTrigger 连续顺序读取这么多个block之后开始预读
+const readaheadTrigger = 2
+
+// readahead 迭代器顺序读取data block时的自适应预读。
+// 每次读取紧接着上一次读取的结束位置时认为是顺序读，连续顺序读之后开始预读，
+// 之后每次预读的大小翻倍直到上限；一旦出现随机读就回到初始状态。
+// 每个迭代器一个，不是并发安全的
+type readahead struct {
+	r       fileReader
+	initial uint64
+	max     uint64
+
+	size    uint64 // 当前的预读大小，0表示还没有开始预读
+	numSeq  int    // 连续顺序读取的次数
+	lastEnd uint64 // 上一次读取的结束位置
+
+	buf       []byte
+	bufOffset uint64
+}
+
+// newReadahead mmap模式下读取不经过系统调用，不需要预读，返回nil
+func (t *Table) newReadahead() *readahead {
+	if t.opts.LoadingMode != LoadingModePread || t.opts.ReadaheadSize <= 0 {
+		return nil
+	}
+	return &readahead{
+		r:       t.file,
+		initial: uint64(t.opts.ReadaheadSize),
+		max:     uint64(max(t.opts.MaxReadaheadSize, t.opts.ReadaheadSize)),
+	}
+}
+
+func (ra *readahead) readAt(offset, size uint64) ([]byte, error) {
+	sequential := offset == ra.lastEnd
+	ra.lastEnd = offset + size
+
+	if offset >= ra.bufOffset && offset+size <= ra.bufOffset+uint64(len(ra.buf)) {
+		// 拷贝出来，避免block cache中的block引用整个预读的buffer
+		start := offset - ra.bufOffset
+		return append([]byte(nil), ra.buf[start:start+size]...), nil
+	}
+
+	if !sequential {
+		ra.numSeq, ra.size, ra.buf = 0, 0, nil
+		return ra.r.readAt(offset, size)
+	}
+	ra.numSeq++
+	if ra.numSeq < readaheadTrigger {
+		return ra.r.readAt(offset, size)
+	}
+
+	if ra.size == 0 {
+		ra.size = ra.initial
+	} else {
+		ra.size = min(ra.size*2, ra.max)
+	}
+	n := min(max(size, ra.size), ra.r.size()-offset)
+	if n < size {
+		// 超出文件范围，由fileReader报告错误
+		return ra.r.readAt(offset, size)
+	}
+	buf, err := ra.r.readAt(offset, n)
+	if err != nil {
+		ra.buf = nil
+		return nil, err
+	}
+	ra.buf, ra.bufOffset = buf, offset
+	return append([]byte(nil), buf[:size]...), nil
+}
+
+// cached 读取的block命中了block cache，不需要读文件，但仍然记录读取的位置，
+// 热数据上的顺序扫描在之后未命中时能继续扩大预读
+func (ra *readahead) cached(offset, size uint64) {
+	if offset == ra.lastEnd {
+		ra.numSeq++
+	} else {
+		ra.numSeq, ra.size, ra.buf = 0, 0, nil
+	}
+	ra.lastEnd = offset + size
+}
@@ -0,0 +1,135 @@
+package table
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/YzmjY/toykv/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+// countingReader 记录每次读取的大小
+type countingReader struct {
+	data  []byte
+	sizes []uint64
+}
+
+func (r *countingReader) readAt(offset, size uint64) ([]byte, error) {
+	r.sizes = append(r.sizes, size)
+	return r.data[offset : offset+size], nil
+}
+
+func (r *countingReader) size() uint64 { return uint64(len(r.data)) }
+func (r *countingReader) close() error { return nil }
+
+func TestReadahead(t *testing.T) {
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	r := &countingReader{data: data}
+	ra := &readahead{r: r, initial: 1 << 10, max: 8 << 10}
+
+	// 顺序读取100字节的block
+	var offset uint64
+	for offset < 64<<10 {
+		buf, err := ra.readAt(offset, 100)
+		require.NoError(t, err)
+		require.Equal(t, data[offset:offset+100], buf)
+		offset += 100
+	}
+	require.Equal(t, []uint64{100, 1 << 10, 2 << 10, 4 << 10, 8 << 10, 8 << 10}, r.sizes[:6])
+	require.Less(t, len(r.sizes), 20)
+
+	// 随机读后回到初始状态
+	r.sizes = nil
+	for _, off := range []uint64{500 << 10, 500<<10 + 100, 500<<10 + 200} {
+		buf, err := ra.readAt(off, 100)
+		require.NoError(t, err)
+		require.Equal(t, data[off:off+100], buf)
+	}
+	require.Equal(t, []uint64{100, 100, 1 << 10}, r.sizes)
+
+	// 预读不会超出文件
+	r.sizes = nil
+	end := uint64(len(data))
+	for _, off := range []uint64{end - 300, end - 200, end - 100} {
+		_, err := ra.readAt(off, 100)
+		require.NoError(t, err)
+	}
+	require.Equal(t, []uint64{100, 100, 100}, r.sizes)
+
+	// 命中block cache的读取也计入顺序读
+	r.sizes = nil
+	ra = &readahead{r: r, initial: 1 << 10, max: 8 << 10}
+	ra.cached(0, 100)
+	ra.cached(100, 100)
+	_, err := ra.readAt(200, 100)
+	require.NoError(t, err)
+	ra.cached(300, 1<<10-100)
+	_, err = ra.readAt(1<<10+200, 100)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1 << 10, 2 << 10}, r.sizes)
+}
+
+func TestDirectReads(t *testing.T) {
+	data := make([]byte, 3*directIOAlignment+123)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	path := filepath.Join(t.TempDir(), "data")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	f, _, err := vfs.OpenDirect(vfs.Default, path)
+	require.NoError(t, err)
+	// 不支持O_DIRECT的文件系统上同样检查对齐读取的逻辑
+	r := &preadReader{f: f, n: uint64(len(data)), direct: true}
+	defer r.close()
+
+	for _, c := range [][2]uint64{
+		{0, 1}, {0, directIOAlignment}, {1, directIOAlignment}, {directIOAlignment - 1, 2},
+		{100, 2 * directIOAlignment}, {uint64(len(data)) - 10, 10}, {0, uint64(len(data))},
+	} {
+		buf, err := r.readAt(c[0], c[1])
+		require.NoError(t, err)
+		require.Equal(t, data[c[0]:c[0]+c[1]], buf)
+	}
+	_, err = r.readAt(uint64(len(data))-10, 11)
+	require.Error(t, err)
+}
+
+func TestTableDirectReadsAndReadahead(t *testing.T) {
+	const n = 5000
+	opts := DefaultOptions()
+	opts.LoadingMode = LoadingModePread
+	opts.UseDirectReads = true
+	opts.ReadaheadSize = 4 << 10
+	opts.MaxReadaheadSize = 64 << 10
+	opts.BlockCache = NewBlockCache(1 << 20)
+
+	tbl, err := Open(buildTestTable(t, n, opts), opts)
+	require.NoError(t, err)
+	defer tbl.Close()
+
+	for _, reversed := range []bool{false, true} {
+		it := tbl.NewIterator(reversed)
+		i := 0
+		for it.Rewind(); it.Vaild(); it.Next() {
+			idx := i
+			if reversed {
+				idx = n - 1 - i
+			}
+			require.Equal(t, tableKey(idx), it.Key())
+			require.Equal(t, tableValue(idx).Value, it.Value().Value)
+			i++
+		}
+		require.NoError(t, it.Error())
+		require.Equal(t, n, i)
+		it.Close()
+	}
+
+	v, err := tbl.Get(tableKey(123))
+	require.NoError(t, err)
+	require.Equal(t, tableValue(123).Value, v.Value)
+}
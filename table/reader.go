@@ -0,0 +1,134 @@
+package table
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/YzmjY/toykv/vfs"
+	"github.com/YzmjY/toykv/x"
+)
+
+// TableFormat table文件的格式
+type TableFormat int
+
+const (
+	// BlockBasedFormat 分block保存，支持压缩、过滤器和block cache，见format.go
+	BlockBasedFormat TableFormat = iota
+	// PlainFormat 只用于mmap的点查场景，记录不分block、不压缩，用hash index定位，见plain_format.go
+	PlainFormat
+)
+
+func (f TableFormat) String() string {
+	switch f {
+	case BlockBasedFormat:
+		return "block-based"
+	case PlainFormat:
+		return "plain"
+	default:
+		return fmt.Sprintf("TableFormat(%d)", int(f))
+	}
+}
+
+// Reader 只读table的公共接口，由Table和PlainTable实现
+type Reader interface {
+	// Get 查找userKey相同、版本不大于key中版本的最新的值，不存在时返回空的ValueStruct
+	Get(key []byte) (x.ValueStruct, error)
+	// NewIterator 迭代器持有table的引用，用完后必须调用Close
+	NewIterator(reversed bool) TableIterator
+
+	Path() string
+	Size() uint64
+	Smallest() []byte
+	Biggest() []byte
+	KeyCount() uint64
+	MaxVersion() uint64
+	Properties() *Properties
+	// RangeDeletions 范围删除，不影响Get和迭代器的结果，由上层合并
+	RangeDeletions() []RangeTombstone
+
+	IncrRef()
+	DecrRef()
+	Close() error
+}
+
+// TableIterator table上的迭代器，迭代结束后需要用Error检查是否遇到了错误
+type TableIterator interface {
+	x.Iterator
+	Error() error
+}
+
+// TableBuilder 构造table的公共接口，由Builder和PlainTableBuilder实现
+type TableBuilder interface {
+	// Add 添加一个kv，key为带时间戳的内部key，需要严格递增
+	Add(key []byte, v x.ValueStruct) error
+	Empty() bool
+	EstimatedSize() uint64
+	Finish() error
+}
+
+var (
+	_ Reader       = &Table{}
+	_ Reader       = &PlainTable{}
+	_ TableBuilder = &Builder{}
+	_ TableBuilder = &PlainTableBuilder{}
+)
+
+// NewTableBuilder 按照opts.Level上的格式创建builder
+func NewTableBuilder(w io.Writer, opts Options) TableBuilder {
+	if opts.FormatForLevel(opts.Level) == PlainFormat {
+		return NewPlainTableBuilder(w, opts)
+	}
+	return NewBuilder(w, opts)
+}
+
+// OpenReader 根据文件末尾的magic判断格式，打开对应的table。
+// opts.GlobalVersion不为0时，返回的Reader把所有key的版本视为这个值
+func OpenReader(path string, opts Options) (Reader, error) {
+	magic, err := readMagic(opts.FileSystem(), path)
+	if err != nil {
+		return nil, err
+	}
+
+	var r Reader
+	switch magic {
+	case plainTableMagic:
+		r, err = OpenPlainTable(path, opts)
+	default:
+		// 包括magic不正确的情况，由Open报告错误
+		r, err = Open(path, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opts.GlobalVersion != 0 {
+		g, err := newGlobalVersionReader(r, opts.GlobalVersion)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("table: open %s: %w", path, err)
+		}
+		return g, nil
+	}
+	return r, nil
+}
+
+func readMagic(fs vfs.FS, path string) (uint64, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if fi.Size() < 8 {
+		return 0, nil
+	}
+	var buf [8]byte
+	if _, err := f.ReadAt(buf[:], fi.Size()-8); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
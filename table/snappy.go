@@ -0,0 +1,196 @@
+package table
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// snappy的block格式（不包括framing）：
+//
+//	| 原始长度(uvarint) | element ... |
+//
+// 每个element以一个tag字节开始，低2位表示类型：
+//
+//	00 literal: 高6位为len-1，60~63表示长度再用1~4个字节（小端）保存
+//	01 copy1:   len为4~11，offset < 2048，高3位为offset的高3位，之后1个字节为offset的低8位
+//	10 copy2:   高6位为len-1，之后2个字节为offset
+//	11 copy4:   高6位为len-1，之后4个字节为offset
+
+const (
+	snappyTagLiteral = 0x00
+	snappyTagCopy1   = 0x01
+	snappyTagCopy2   = 0x02
+	snappyTagCopy4   = 0x03
+
+	snappyTableBits = 14
+	// 短于这个长度的输入直接作为literal保存
+	snappyMinNonLiteral = 17
+	// 解压后允许的最大长度，防止损坏的数据导致分配过大的内存
+	snappyMaxDecodedLen = 1 << 32
+)
+
+var errBadSnappy = errors.New("table: bad snappy data")
+
+func snappyEncode(dst, src []byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(src)))
+	if len(src) < snappyMinNonLiteral {
+		return snappyEmitLiteral(dst, src)
+	}
+
+	// table中保存的是位置+1，0表示空
+	var table [1 << snappyTableBits]int32
+	lit := 0
+	for i := 0; i+4 <= len(src); {
+		cur := binary.LittleEndian.Uint32(src[i:])
+		h := snappyHash(cur)
+		cand := int(table[h]) - 1
+		table[h] = int32(i + 1)
+
+		if cand < 0 || binary.LittleEndian.Uint32(src[cand:]) != cur {
+			i++
+			continue
+		}
+
+		dst = snappyEmitLiteral(dst, src[lit:i])
+		n := 4
+		for i+n < len(src) && src[cand+n] == src[i+n] {
+			n++
+		}
+		dst = snappyEmitCopy(dst, i-cand, n)
+		i += n
+		lit = i
+	}
+
+	return snappyEmitLiteral(dst, src[lit:])
+}
+
+func snappyHash(v uint32) uint32 {
+	return (v * 0x1e35a7bd) >> (32 - snappyTableBits)
+}
+
+func snappyEmitLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+
+	n := uint32(len(lit) - 1)
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2|snappyTagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|snappyTagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|snappyTagLiteral, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+func snappyEmitCopy(dst []byte, offset, n int) []byte {
+	// 每个copy最多64个字节，保证拆分后剩下的部分不少于4个字节
+	for n >= 68 {
+		dst = snappyEmitCopyN(dst, offset, 64)
+		n -= 64
+	}
+	if n > 64 {
+		dst = snappyEmitCopyN(dst, offset, 60)
+		n -= 60
+	}
+	if n >= 4 && n <= 11 && offset < 2048 {
+		return append(dst, byte(offset>>8)<<5|byte(n-4)<<2|snappyTagCopy1, byte(offset))
+	}
+	return snappyEmitCopyN(dst, offset, n)
+}
+
+func snappyEmitCopyN(dst []byte, offset, n int) []byte {
+	if offset < 1<<16 {
+		return append(dst, byte(n-1)<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+	}
+	return append(dst, byte(n-1)<<2|snappyTagCopy4, byte(offset), byte(offset>>8), byte(offset>>16), byte(offset>>24))
+}
+
+// snappyMaxExpansion 每个压缩字节最多解压出的字节数：3字节的copy2最多复制64字节
+const snappyMaxExpansion = 22
+
+func snappyDecode(src []byte) ([]byte, error) {
+	dLen, n := binary.Uvarint(src)
+	if n <= 0 || dLen > snappyMaxDecodedLen {
+		return nil, errBadSnappy
+	}
+	src = src[n:]
+	// 分配内存之前检查长度，损坏的头部不能让一个很小的block分配GB级别的内存
+	if dLen > uint64(len(src))*snappyMaxExpansion {
+		return nil, errBadSnappy
+	}
+
+	dst := make([]byte, 0, dLen)
+	for len(src) > 0 {
+		tag := src[0]
+		var length, offset int
+
+		switch tag & 0x03 {
+		case snappyTagLiteral:
+			x := int(tag >> 2)
+			src = src[1:]
+			if x >= 60 {
+				nBytes := x - 59
+				if len(src) < nBytes {
+					return nil, errBadSnappy
+				}
+				x = 0
+				for i := nBytes - 1; i >= 0; i-- {
+					x = x<<8 | int(src[i])
+				}
+				src = src[nBytes:]
+			}
+			length = x + 1
+			if len(src) < length || uint64(len(dst)+length) > dLen {
+				return nil, errBadSnappy
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+
+		case snappyTagCopy1:
+			if len(src) < 2 {
+				return nil, errBadSnappy
+			}
+			length = 4 + int(tag>>2)&0x07
+			offset = int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+
+		case snappyTagCopy2:
+			if len(src) < 3 {
+				return nil, errBadSnappy
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+
+		case snappyTagCopy4:
+			if len(src) < 5 {
+				return nil, errBadSnappy
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+
+		if offset <= 0 || offset > len(dst) || uint64(len(dst)+length) > dLen {
+			return nil, errBadSnappy
+		}
+		// 源和目标可能重叠，逐字节拷贝
+		start := len(dst) - offset
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[start+i])
+		}
+	}
+
+	if uint64(len(dst)) != dLen {
+		return nil, errBadSnappy
+	}
+	return dst, nil
+}
@@ -0,0 +1,191 @@
+package table
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/YzmjY/toykv/vfs"
+	"github.com/YzmjY/toykv/x"
+)
+
+var (
+	ErrBadRange     = errors.New("table: range deletion start must be less than end")
+	ErrEmptySstFile = errors.New("table: cannot finish an sst file with no entries")
+	errWriterDone   = errors.New("table: sst file writer already finished")
+)
+
+// SstFileInfo SstFileWriter.Finish写出的文件信息
+type SstFileInfo struct {
+	Path string
+	// Smallest、Biggest 点操作（Put和Delete）中最小和最大的内部key，只有范围删除时为nil
+	Smallest []byte
+	Biggest  []byte
+	// RangeDelStart、RangeDelEnd 所有范围删除覆盖的userKey范围[RangeDelStart, RangeDelEnd)，
+	// 没有范围删除时为nil
+	RangeDelStart []byte
+	RangeDelEnd   []byte
+
+	NumEntries        uint64
+	NumRangeDeletions uint64
+	Size              uint64
+}
+
+// SstFileWriter 不依赖DB实例，离线生成一个可以被导入的table文件。
+// 与Builder不同，key的顺序由调用方保证，错误的输入返回error而不是panic。
+// 总是使用block格式，plain格式不支持范围删除
+type SstFileWriter struct {
+	fs   vfs.FS
+	path string
+	f    vfs.File
+	w    *bufio.Writer
+	b    *Builder
+
+	lastKey []byte
+	info    SstFileInfo
+	err     error
+}
+
+// NewSstFileWriter 创建path对应的文件，文件不能已经存在
+func NewSstFileWriter(path string, opts Options) (*SstFileWriter, error) {
+	fs := opts.FileSystem()
+	f, err := fs.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriterSize(f, 1<<20)
+	return &SstFileWriter{
+		fs:   fs,
+		path: path,
+		f:    f,
+		w:    w,
+		b:    NewBuilder(w, opts),
+		info: SstFileInfo{Path: path},
+	}, nil
+}
+
+// Put 添加一个kv，key为带时间戳的内部key，必须按x.KeysCompare严格递增。
+// key中的操作类型会被设置为x.ValueTypeValue
+func (w *SstFileWriter) Put(key []byte, v x.ValueStruct) error {
+	return w.add(key, x.ValueTypeValue, v)
+}
+
+// Delete 添加一个删除标记，顺序要求与Put相同
+func (w *SstFileWriter) Delete(key []byte) error {
+	return w.add(key, x.ValueTypeDelete, x.ValueStruct{Meta: x.BitDelete})
+}
+
+// SingleDelete 与Delete相同，调用方保证这个userKey只被写入过一次
+func (w *SstFileWriter) SingleDelete(key []byte) error {
+	return w.add(key, x.ValueTypeSingleDelete, x.ValueStruct{Meta: x.BitDelete})
+}
+
+func (w *SstFileWriter) add(key []byte, typ x.ValueType, v x.ValueStruct) error {
+	if err := w.checkKey(key); err != nil {
+		return err
+	}
+	key = x.WithValueType(key, typ)
+	if err := w.b.Add(key, v); err != nil {
+		w.err = err
+		return err
+	}
+
+	if w.info.Smallest == nil {
+		w.info.Smallest = append([]byte(nil), key...)
+	}
+	w.lastKey = append(w.lastKey[:0], key...)
+	w.info.NumEntries++
+	return nil
+}
+
+// DeleteRange 删除userKey在[start, end)之间、版本不大于version的key，
+// 与Put、Delete之间没有顺序要求
+func (w *SstFileWriter) DeleteRange(start, end []byte, version uint64) error {
+	if w.err != nil {
+		return w.err
+	}
+	if bytes.Compare(start, end) >= 0 {
+		return fmt.Errorf("%w: [%q, %q)", ErrBadRange, start, end)
+	}
+	if err := x.CheckVersion(version); err != nil {
+		return err
+	}
+	if err := w.b.AddRangeDeletion(start, end, version); err != nil {
+		w.err = err
+		return err
+	}
+
+	if w.info.RangeDelStart == nil || bytes.Compare(start, w.info.RangeDelStart) < 0 {
+		w.info.RangeDelStart = append([]byte(nil), start...)
+	}
+	if bytes.Compare(end, w.info.RangeDelEnd) > 0 {
+		w.info.RangeDelEnd = append([]byte(nil), end...)
+	}
+	w.info.NumRangeDeletions++
+	return nil
+}
+
+func (w *SstFileWriter) checkKey(key []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	// 在交给Builder之前检查，拒绝的key不影响后续的写入
+	return checkKeyOrder(w.lastKey, key)
+}
+
+// Finish 写完并sync文件和所在的目录，返回文件的key范围和大小。
+// 失败时删除文件，之后的所有调用都返回错误
+func (w *SstFileWriter) Finish() (SstFileInfo, error) {
+	if w.err != nil {
+		return SstFileInfo{}, w.err
+	}
+	if w.info.NumEntries == 0 && w.info.NumRangeDeletions == 0 {
+		w.Abort()
+		return SstFileInfo{}, ErrEmptySstFile
+	}
+	if w.info.NumEntries > 0 {
+		w.info.Biggest = append([]byte(nil), w.lastKey...)
+	}
+
+	err := w.b.Finish()
+	if err == nil {
+		err = w.w.Flush()
+	}
+	if err == nil {
+		err = w.f.Sync()
+	}
+	if err == nil {
+		var fi os.FileInfo
+		if fi, err = w.f.Stat(); err == nil {
+			w.info.Size = uint64(fi.Size())
+		}
+	}
+	if err != nil {
+		w.Abort()
+		return SstFileInfo{}, err
+	}
+
+	err = w.f.Close()
+	w.err = errWriterDone
+	if err == nil {
+		err = w.fs.SyncDir(filepath.Dir(w.path))
+	}
+	if err != nil {
+		w.fs.Remove(w.path)
+		return SstFileInfo{}, err
+	}
+	return w.info, nil
+}
+
+// Abort 放弃写入，删除已经写出的文件
+func (w *SstFileWriter) Abort() {
+	if w.err == errWriterDone {
+		return
+	}
+	w.err = errWriterDone
+	w.f.Close()
+	w.fs.Remove(w.path)
+}
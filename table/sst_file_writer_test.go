@@ -0,0 +1,170 @@
+package table
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/YzmjY/toykv/vfs"
+	"github.com/YzmjY/toykv/x"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSstFileWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ext.sst")
+	w, err := NewSstFileWriter(path, DefaultOptions())
+	require.NoError(t, err)
+
+	const n = 1000
+	for i := 0; i < n; i++ {
+		key := x.KeyWithTs([]byte(fmt.Sprintf("key%06d", i)), 0)
+		if i%10 == 0 {
+			require.NoError(t, w.Delete(key))
+			continue
+		}
+		require.NoError(t, w.Put(key, x.ValueStruct{Value: []byte(fmt.Sprint(i))}))
+	}
+	require.NoError(t, w.DeleteRange([]byte("key002000"), []byte("key003000"), 0))
+	require.NoError(t, w.DeleteRange([]byte("a"), []byte("b"), 0))
+
+	info, err := w.Finish()
+	require.NoError(t, err)
+	require.Equal(t, path, info.Path)
+	// 操作类型记录在key中
+	require.Equal(t, x.MakeInternalKey([]byte("key000000"), 0, x.ValueTypeDelete), info.Smallest)
+	require.Equal(t, x.KeyWithTs([]byte("key000999"), 0), info.Biggest)
+	require.Equal(t, []byte("a"), info.RangeDelStart)
+	require.Equal(t, []byte("key003000"), info.RangeDelEnd)
+	require.EqualValues(t, n, info.NumEntries)
+	require.EqualValues(t, 2, info.NumRangeDeletions)
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	require.EqualValues(t, fi.Size(), info.Size)
+
+	r, err := OpenReader(path, DefaultOptions())
+	require.NoError(t, err)
+	defer r.Close()
+	require.EqualValues(t, n, r.KeyCount())
+	require.EqualValues(t, n/10, r.Properties().NumTombstones)
+	require.EqualValues(t, 2, r.Properties().NumRangeDeletions)
+
+	v, err := r.Get(x.KeyWithTs([]byte("key000010"), 0))
+	require.NoError(t, err)
+	require.Equal(t, x.BitDelete, v.Meta&x.BitDelete)
+	v, err = r.Get(x.KeyWithTs([]byte("key000011"), 0))
+	require.NoError(t, err)
+	require.Equal(t, "11", string(v.Value))
+
+	dels := r.RangeDeletions()
+	require.Len(t, dels, 2)
+	require.Equal(t, RangeTombstone{Start: []byte("a"), End: []byte("b")}, dels[0])
+	require.True(t, dels[1].Deletes(x.KeyWithTs([]byte("key002500"), 0)))
+	require.False(t, dels[1].Deletes(x.KeyWithTs([]byte("key003000"), 0)))
+	require.False(t, dels[1].Deletes(x.KeyWithTs([]byte("key002500"), 1)))
+}
+
+func TestSstFileWriterRejects(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ext.sst")
+	w, err := NewSstFileWriter(path, DefaultOptions())
+	require.NoError(t, err)
+
+	require.NoError(t, w.Put(x.KeyWithTs([]byte("b"), 0), x.ValueStruct{Value: []byte("v")}))
+	// 相同的key、更小的key都不允许，新版本排在旧版本前面
+	require.ErrorIs(t, w.Put(x.KeyWithTs([]byte("b"), 0), x.ValueStruct{}), ErrKeyOrder)
+	require.ErrorIs(t, w.Delete(x.KeyWithTs([]byte("a"), 0)), ErrKeyOrder)
+	require.ErrorIs(t, w.Put(x.KeyWithTs([]byte("b"), 1), x.ValueStruct{}), ErrKeyOrder)
+	require.ErrorIs(t, w.Put([]byte("c"), x.ValueStruct{}), ErrKeyTooShort)
+	require.ErrorIs(t, w.DeleteRange([]byte("z"), []byte("a"), 0), ErrBadRange)
+	require.ErrorIs(t, w.DeleteRange([]byte("x"), []byte("y"), x.MaxVersion+1), x.ErrVersionTooLarge)
+
+	// 拒绝的输入不影响后续的写入
+	require.NoError(t, w.Put(x.KeyWithTs([]byte("c"), 0), x.ValueStruct{Value: []byte("v")}))
+	_, err = w.Finish()
+	require.NoError(t, err)
+	_, err = w.Finish()
+	require.Error(t, err)
+
+	// 文件已存在
+	_, err = NewSstFileWriter(path, DefaultOptions())
+	require.Error(t, err)
+
+	// 空文件会被删除
+	empty := filepath.Join(dir, "empty.sst")
+	w, err = NewSstFileWriter(empty, DefaultOptions())
+	require.NoError(t, err)
+	_, err = w.Finish()
+	require.ErrorIs(t, err, ErrEmptySstFile)
+	_, err = os.Stat(empty)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestSstFileWriterOnlyRangeDeletions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ext.sst")
+	w, err := NewSstFileWriter(path, DefaultOptions())
+	require.NoError(t, err)
+	require.NoError(t, w.DeleteRange([]byte("a"), []byte("m"), 0))
+	info, err := w.Finish()
+	require.NoError(t, err)
+	require.Nil(t, info.Smallest)
+	require.Nil(t, info.Biggest)
+
+	r, err := OpenReader(path, DefaultOptions())
+	require.NoError(t, err)
+	defer r.Close()
+	require.Zero(t, r.KeyCount())
+	require.Len(t, r.RangeDeletions(), 1)
+
+	it := r.NewIterator(false)
+	defer it.Close()
+	it.Rewind()
+	require.False(t, it.Vaild())
+	require.NoError(t, it.Error())
+}
+
+func TestSstFileWriterFaults(t *testing.T) {
+	fs := vfs.NewFaultFS(vfs.NewMemFS())
+	opts := DefaultOptions()
+	opts.FS = fs
+
+	write := func(path string, n int) *SstFileWriter {
+		w, err := NewSstFileWriter(path, opts)
+		require.NoError(t, err)
+		for i := 0; i < n; i++ {
+			key := x.KeyWithTs([]byte(fmt.Sprintf("key%06d", i)), 0)
+			require.NoError(t, w.Put(key, x.ValueStruct{Value: []byte(fmt.Sprint(i))}))
+		}
+		return w
+	}
+
+	// Finish之前崩溃，文件中没有任何数据
+	write("/db/unfinished.sst", 1000)
+	_, err := write("/db/finished.sst", 1000).Finish()
+	require.NoError(t, err)
+	require.NoError(t, fs.DropUnsyncedWrites())
+
+	_, err = OpenReader("/db/unfinished.sst", opts)
+	require.Error(t, err)
+	// 不是操作系统上的文件，mmap模式退化为pread
+	r, err := OpenReader("/db/finished.sst", opts)
+	require.NoError(t, err)
+	v, err := r.Get(x.KeyWithTs([]byte("key000500"), 0))
+	require.NoError(t, err)
+	require.Equal(t, "500", string(v.Value))
+	require.NoError(t, r.Close())
+
+	// 写到一半磁盘写满，失败的文件被删除
+	fs.SetWriteLimit(4 << 10)
+	_, err = write("/db/full.sst", 1000).Finish()
+	require.ErrorIs(t, err, vfs.ErrInjected)
+	_, err = fs.Stat("/db/full.sst")
+	require.True(t, os.IsNotExist(err))
+	fs.SetWriteLimit(-1)
+
+	// 读取时的IO错误
+	fs.InjectErrors(func(op vfs.Op, name string) bool { return op == vfs.OpRead })
+	_, err = OpenReader("/db/finished.sst", opts)
+	require.ErrorIs(t, err, syscall.EIO)
+}
@@ -1 +1,518 @@
 package table
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/YzmjY/toykv/bloomfilter"
+	"github.com/YzmjY/toykv/x"
+)
+
+// Table 一个只读的table文件
+type Table struct {
+	path string
+	opts Options
+	file fileReader
+
+	footer footer
+	props  Properties
+	// index 常驻内存的index block，使用block cache且没有pin时为nil，每次从cache中读取
+	index *block
+
+	// 过滤器，policy未知时为nil，此时不做过滤
+	filterPolicy bloomfilter.FilterPoliy
+	// filter 常驻内存的完整过滤器，为nil时通过filterHandle从cache中读取
+	filter            []byte
+	filterHandle      blockHandle
+	partitionedFilter *bloomfilter.PartitionedFilter
+
+	// rangeDels 范围删除，数量很少，打开时全部加载
+	rangeDels []RangeTombstone
+
+	// cacheID 在block cache中区分不同的table，每次打开都分配新的id
+	cacheID uint64
+	// pinned 在block cache中pin住的block的offset，关闭时释放
+	pinned []uint64
+
+	ref atomic.Int32
+	// closed Close只释放一次Open持有的引用
+	closed atomic.Bool
+}
+
+// errRefUnderflow DecrRef的次数多于IncrRef
+var errRefUnderflow = errors.New("table: reference count dropped below zero")
+
+var nextCacheID atomic.Uint64
+
+// Open 打开一个table文件，校验footer并加载index和过滤器
+func Open(path string, opts Options) (*Table, error) {
+	file, err := openFileReader(opts.FileSystem(), path, opts.LoadingMode, opts.UseDirectReads)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Table{
+		path:    path,
+		opts:    opts,
+		file:    file,
+		cacheID: nextCacheID.Add(1),
+	}
+	t.ref.Store(1)
+	if err := t.load(); err != nil {
+		t.releaseCache()
+		file.close()
+		return nil, fmt.Errorf("table: open %s: %w", path, err)
+	}
+
+	return t, nil
+}
+
+func (t *Table) load() error {
+	size := t.file.size()
+	if size < footerSize {
+		return t.corruption(0, BlockTypeFooter, errBadMagic)
+	}
+	data, err := t.file.readAt(size-footerSize, footerSize)
+	if err != nil {
+		return err
+	}
+	if t.footer, err = decodeFooter(data); err != nil {
+		if errors.Is(err, errBadMagic) {
+			return t.corruption(size-footerSize, BlockTypeFooter, err)
+		}
+		return err
+	}
+
+	data, resident, err := t.loadResident(t.footer.index, BlockTypeIndex)
+	if err != nil {
+		return err
+	}
+	index, err := newBlock(data)
+	if err != nil {
+		return t.corruption(t.footer.index.offset, BlockTypeIndex, err)
+	}
+	if resident {
+		t.index = index
+	}
+
+	return t.loadMeta()
+}
+
+func (t *Table) loadMeta() error {
+	metaindex := t.footer.metaindex
+	data, err := t.readBlock(metaindex, BlockTypeMetaIndex)
+	if err != nil {
+		return err
+	}
+	b, err := newBlock(data)
+	if err != nil {
+		return t.corruption(metaindex.offset, BlockTypeMetaIndex, err)
+	}
+	b.minKeyLen = 0 // key为meta block的名字
+
+	meta := make(map[string][]byte)
+	iter := b.newIterator()
+	for iter.SeekToFirst(); iter.Vaild(); iter.Next() {
+		meta[string(iter.Key())] = iter.RawValue()
+	}
+	if err := iter.Error(); err != nil {
+		return t.corruption(metaindex.offset, BlockTypeMetaIndex, err)
+	}
+
+	propsHandle, err := decodeBlockHandle(meta[metaProperties])
+	if err != nil {
+		return t.corruption(metaindex.offset, BlockTypeMetaIndex, err)
+	}
+	if data, err = t.readBlock(propsHandle, BlockTypeProperties); err != nil {
+		return err
+	}
+	if t.props, err = decodeProperties(data); err != nil {
+		return t.corruption(propsHandle.offset, BlockTypeProperties, err)
+	}
+
+	if err := t.loadRangeDels(meta); err != nil {
+		return err
+	}
+	return t.loadFilter(meta)
+}
+
+func (t *Table) loadRangeDels(meta map[string][]byte) error {
+	v, ok := meta[metaRangeDel]
+	if !ok {
+		return nil
+	}
+	h, err := decodeBlockHandle(v)
+	if err != nil {
+		return t.corruption(t.footer.metaindex.offset, BlockTypeMetaIndex, err)
+	}
+	data, err := t.readBlock(h, BlockTypeRangeDel)
+	if err != nil {
+		return err
+	}
+	if t.rangeDels, err = decodeRangeDels(data); err != nil {
+		return t.corruption(h.offset, BlockTypeRangeDel, err)
+	}
+	return nil
+}
+
+func (t *Table) loadFilter(meta map[string][]byte) error {
+	policyMeta, ok := meta[metaFilterPolicy]
+	if !ok {
+		return nil
+	}
+	m, err := bloomfilter.DecodePolicyMeta(policyMeta)
+	if err != nil {
+		return t.corruption(t.footer.metaindex.offset, BlockTypeMetaIndex, err)
+	}
+	policy, ok := bloomfilter.Lookup(m)
+	if !ok {
+		// 不认识的过滤器直接忽略，不能给出错误的否定答案
+		return nil
+	}
+
+	if v, ok := meta[metaFilter]; ok {
+		h, err := decodeBlockHandle(v)
+		if err != nil {
+			return t.corruption(t.footer.metaindex.offset, BlockTypeMetaIndex, err)
+		}
+		filter, resident, err := t.loadResident(h, BlockTypeFilter)
+		if err != nil {
+			return err
+		}
+		if resident {
+			t.filter = filter
+		}
+		t.filterHandle = h
+		t.filterPolicy = policy
+		return nil
+	}
+
+	if v, ok := meta[metaFilterPartitionIdx]; ok {
+		indexHandle, err := decodeBlockHandle(v)
+		if err != nil {
+			return t.corruption(t.footer.metaindex.offset, BlockTypeMetaIndex, err)
+		}
+		index, err := t.readBlock(indexHandle, BlockTypeFilterIndex)
+		if err != nil {
+			return err
+		}
+
+		t.partitionedFilter, err = bloomfilter.NewPartitionedFilter(policy, index, func(offset, size uint64) ([]byte, error) {
+			return t.readBlockCached(blockHandle{offset: offset, size: size}, BlockTypeFilterPartition)
+		})
+		if err != nil {
+			return t.corruption(indexHandle.offset, BlockTypeFilterIndex, err)
+		}
+		t.filterPolicy = policy
+	}
+
+	return nil
+}
+
+func (t *Table) corruption(offset uint64, typ BlockType, err error) error {
+	return &CorruptionError{
+		File:      t.path,
+		Offset:    offset,
+		BlockType: typ,
+		Err:       err,
+	}
+}
+
+// readBlock 读取一个block，校验checksum并解压，返回的数据不包括trailer。
+// 设置了SkipChecksumVerification时，data block不做校验
+func (t *Table) readBlock(h blockHandle, typ BlockType) ([]byte, error) {
+	return t.readBlockFrom(t.file, h, typ)
+}
+
+// readBlockFrom 通过r读取block，迭代器通过readahead读取data block
+func (t *Table) readBlockFrom(r blockReader, h blockHandle, typ BlockType) ([]byte, error) {
+	// 损坏的handle中size接近MaxUint64时，加上trailer会溢出成一个很小的长度
+	if h.size > t.file.size() || h.size+blockTrailerSize < h.size {
+		return nil, t.corruption(h.offset, typ, errBadHandle)
+	}
+	data, err := r.readAt(h.offset, h.size+blockTrailerSize)
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// handle超出了文件范围
+			return nil, t.corruption(h.offset, typ, err)
+		}
+		return nil, err
+	}
+
+	content := data[:h.size]
+	compression := CompressionType(data[h.size])
+	if typ != BlockTypeData || !t.opts.SkipChecksumVerification {
+		if binary.LittleEndian.Uint32(data[h.size+1:]) != checksum(content, compression) {
+			return nil, t.corruption(h.offset, typ, errChecksumMismatch)
+		}
+	}
+
+	content, err = decompressBlock(compression, content)
+	if err != nil {
+		return nil, t.corruption(h.offset, typ, err)
+	}
+	return content, nil
+}
+
+// readBlockCached 优先从block cache中读取block，未命中时读取文件并放入cache
+func (t *Table) readBlockCached(h blockHandle, typ BlockType) ([]byte, error) {
+	return t.readBlockCachedFrom(t.file, h, typ)
+}
+
+func (t *Table) readBlockCachedFrom(r blockReader, h blockHandle, typ BlockType) ([]byte, error) {
+	c := t.opts.BlockCache
+	if c == nil {
+		return t.readBlockFrom(r, h, typ)
+	}
+	if data, ok := c.get(t.cacheID, h.offset, typ); ok {
+		if ra, ok := r.(*readahead); ok {
+			ra.cached(h.offset, h.size+blockTrailerSize)
+		}
+		return data, nil
+	}
+
+	data, err := t.readBlockFrom(r, h, typ)
+	if err != nil {
+		return nil, err
+	}
+	if t.opts.LoadingMode == LoadingModeMmap {
+		// 未压缩的block指向映射的内存，table关闭后不能再访问
+		data = append([]byte(nil), data...)
+	}
+	c.set(t.cacheID, h.offset, typ, data, false)
+	return data, nil
+}
+
+// pinBlocks 是否把index和filter block pin在block cache中
+func (t *Table) pinBlocks() bool {
+	return t.opts.BlockCache != nil && t.opts.PinL0FilterAndIndexBlocks && t.opts.Level == 0
+}
+
+// loadResident 读取index或filter block。没有block cache或者需要pin时常驻在table中，
+// resident为true；否则只放入block cache，之后每次从cache中读取
+func (t *Table) loadResident(h blockHandle, typ BlockType) ([]byte, bool, error) {
+	if !t.pinBlocks() {
+		data, err := t.readBlockCached(h, typ)
+		return data, t.opts.BlockCache == nil, err
+	}
+
+	data, err := t.readBlock(h, typ)
+	if err != nil {
+		return nil, false, err
+	}
+	// 常驻的block只在cache中记账，不会被淘汰
+	t.opts.BlockCache.set(t.cacheID, h.offset, typ, data, true)
+	t.pinned = append(t.pinned, h.offset)
+	return data, true, nil
+}
+
+func (t *Table) releaseCache() {
+	for _, offset := range t.pinned {
+		t.opts.BlockCache.remove(t.cacheID, offset)
+	}
+	t.pinned = nil
+}
+
+// indexBlock 返回index block，不常驻时从block cache中读取
+func (t *Table) indexBlock() (*block, error) {
+	if t.index != nil {
+		return t.index, nil
+	}
+	data, err := t.readBlockCached(t.footer.index, BlockTypeIndex)
+	if err != nil {
+		return nil, err
+	}
+	index, err := newBlock(data)
+	if err != nil {
+		return nil, t.corruption(t.footer.index.offset, BlockTypeIndex, err)
+	}
+	return index, nil
+}
+
+// keyMayMatch 用过滤器判断key是否可能存在
+func (t *Table) keyMayMatch(key []byte) bool {
+	if t.filterPolicy == nil {
+		return true
+	}
+
+	var mayMatch bool
+	if t.partitionedFilter != nil {
+		mayMatch = t.partitionedFilter.KeyMayMatch(key)
+	} else if t.filter != nil {
+		mayMatch = t.filterPolicy.KeyMayMatch(x.ParseUserKey(key), t.filter)
+	} else {
+		filter, err := t.readBlockCached(t.filterHandle, BlockTypeFilter)
+		// 读取失败时不能过滤，交给后面的查找
+		mayMatch = err != nil || t.filterPolicy.KeyMayMatch(x.ParseUserKey(key), filter)
+	}
+
+	if t.opts.FilterMetrics != nil {
+		t.opts.FilterMetrics.RecordMayMatch(mayMatch)
+	}
+	return mayMatch
+}
+
+// RangeMayMatch table中是否可能有userKey在[lo, hi)之间的key，hi为nil表示没有上界。
+// 只有过滤器策略实现了bloomfilter.RangeFilterPoliy时才能过滤，分区过滤器不支持范围查询
+func (t *Table) RangeMayMatch(lo, hi []byte) bool {
+	rp, ok := t.filterPolicy.(bloomfilter.RangeFilterPoliy)
+	if !ok || t.partitionedFilter != nil {
+		return true
+	}
+
+	filter := t.filter
+	if filter == nil {
+		var err error
+		filter, err = t.readBlockCached(t.filterHandle, BlockTypeFilter)
+		if err != nil {
+			return true
+		}
+	}
+	return rp.RangeMayMatch(lo, hi, filter)
+}
+
+// Get 查找userKey相同、版本不大于key中版本的最新的值，不存在时返回空的ValueStruct。
+// key不是合法的内部key时返回x.ErrBadInternalKey
+func (t *Table) Get(key []byte) (x.ValueStruct, error) {
+	if _, err := x.ParseInternalKey(key); err != nil {
+		return x.ValueStruct{}, err
+	}
+	if !t.keyMayMatch(key) {
+		return x.ValueStruct{}, nil
+	}
+
+	v, found, err := t.get(key)
+	if err != nil {
+		return x.ValueStruct{}, err
+	}
+	if !found && t.filterPolicy != nil && t.opts.FilterMetrics != nil {
+		t.opts.FilterMetrics.RecordFalsePositive()
+	}
+	return v, nil
+}
+
+func (t *Table) get(key []byte) (x.ValueStruct, bool, error) {
+	indexIter, err := t.newIndexIterator()
+	if err != nil {
+		return x.ValueStruct{}, false, err
+	}
+	indexIter.Seek(key)
+	if !indexIter.Vaild() {
+		return x.ValueStruct{}, false, indexIter.Error()
+	}
+
+	blockIter, h, err := t.loadDataBlock(indexIter, t.file)
+	if err != nil {
+		return x.ValueStruct{}, false, err
+	}
+
+	if !blockIter.seekForGet(key) || !blockIter.Vaild() {
+		if err := blockIter.Error(); err != nil {
+			return x.ValueStruct{}, false, t.corruption(h.offset, BlockTypeData, err)
+		}
+		return x.ValueStruct{}, false, nil
+	}
+	if !x.SameUserKey(blockIter.Key(), key) {
+		return x.ValueStruct{}, false, nil
+	}
+
+	v := blockIter.Value()
+	v.Version = x.ParseTs(blockIter.Key())
+	return v, true, nil
+}
+
+// loadDataBlock 通过r加载index迭代器当前指向的data block
+func (t *Table) loadDataBlock(indexIter *indexIterator, r blockReader) (*blockIterator, blockHandle, error) {
+	h, err := decodeBlockHandle(indexIter.RawValue())
+	if err != nil {
+		return nil, h, indexIter.corruption(err)
+	}
+	data, err := t.readBlockCachedFrom(r, h, BlockTypeData)
+	if err != nil {
+		return nil, h, err
+	}
+	blockIter, err := newDataBlockIterator(data)
+	if err != nil {
+		return nil, h, t.corruption(h.offset, BlockTypeData, err)
+	}
+	return blockIter, h, nil
+}
+
+func (t *Table) Path() string {
+	return t.path
+}
+
+// Size table文件的大小
+func (t *Table) Size() uint64 {
+	return t.file.size()
+}
+
+// Smallest 最小的key
+func (t *Table) Smallest() []byte {
+	return t.props.Smallest
+}
+
+// Biggest 最大的key
+func (t *Table) Biggest() []byte {
+	return t.props.Biggest
+}
+
+// KeyCount table中kv的个数
+func (t *Table) KeyCount() uint64 {
+	return t.props.NumEntries
+}
+
+// MaxVersion table中所有key的最大版本
+func (t *Table) MaxVersion() uint64 {
+	return t.props.MaxVersion
+}
+
+// Properties 构造table时统计的属性
+func (t *Table) Properties() *Properties {
+	return &t.props
+}
+
+// RangeDeletions table中的范围删除，按Start排序
+func (t *Table) RangeDeletions() []RangeTombstone {
+	return t.rangeDels
+}
+
+// HasFilter 是否有可用的过滤器
+func (t *Table) HasFilter() bool {
+	return t.filterPolicy != nil
+}
+
+func (t *Table) IncrRef() {
+	t.ref.Add(1)
+}
+
+// DecrRef 引用计数减为0时关闭文件
+func (t *Table) DecrRef() {
+	_ = t.decrRef()
+}
+
+func (t *Table) decrRef() error {
+	new := t.ref.Add(-1)
+	if new > 0 {
+		// still alive
+		return nil
+	}
+	if new < 0 {
+		return errRefUnderflow
+	}
+
+	t.releaseCache()
+	return t.file.close()
+}
+
+// Close 释放Open时持有的引用，还有打开的迭代器时文件在迭代器关闭后才关闭，
+// 重复调用直接返回nil
+func (t *Table) Close() error {
+	if t.closed.Swap(true) {
+		return nil
+	}
+	return t.decrRef()
+}
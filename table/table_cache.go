@@ -0,0 +1,133 @@
+package table
+
+import (
+	"container/list"
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// TableFileName id对应的table文件的路径
+func TableFileName(dir string, id uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d.sst", id))
+}
+
+type tableCacheEntry struct {
+	id uint64
+	t  Reader
+}
+
+// TableCache 限制同时打开的table个数，按LRU关闭不常用的table，访问时再重新打开。
+// 缓存本身持有每个table的一个引用，被淘汰时释放，正在使用的table在使用方
+// 释放引用之后才真正关闭
+type TableCache struct {
+	dir  string
+	opts Options
+
+	mu       sync.Mutex
+	capacity int
+	lru      list.List // 表头为最近使用的
+	tables   map[uint64]*list.Element
+}
+
+// NewTableCache capacity为最多缓存的table个数，小于1时按1处理
+func NewTableCache(dir string, capacity int, opts Options) *TableCache {
+	capacity = max(capacity, 1)
+	return &TableCache{
+		dir:      dir,
+		opts:     opts,
+		capacity: capacity,
+		tables:   make(map[uint64]*list.Element),
+	}
+}
+
+// Get 返回id对应的table，不在缓存中时按文件的格式打开，globalVersion见Options.GlobalVersion。
+// 返回的table增加了引用计数，用完后调用DecrRef
+func (c *TableCache) Get(id uint64, level int, globalVersion uint64) (Reader, error) {
+	if t := c.lookup(id); t != nil {
+		return t, nil
+	}
+
+	// 打开文件时不持有锁，不阻塞其他table的查找
+	opts := c.opts
+	opts.Level = level
+	opts.GlobalVersion = globalVersion
+	if opts.FilterMetricsSet != nil {
+		opts.FilterMetrics = opts.FilterMetricsSet.ForTable(level, id)
+	}
+	t, err := OpenReader(TableFileName(c.dir, id), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.tables[id]; ok {
+		// 其他goroutine已经打开了
+		t.DecrRef()
+		c.lru.MoveToFront(elem)
+		t = elem.Value.(*tableCacheEntry).t
+		t.IncrRef()
+		return t, nil
+	}
+
+	// 先增加调用方的引用，即使新打开的table马上被淘汰也不会关闭
+	t.IncrRef()
+	c.tables[id] = c.lru.PushFront(&tableCacheEntry{id: id, t: t})
+	for c.lru.Len() > c.capacity {
+		c.removeLocked(c.lru.Back())
+	}
+	return t, nil
+}
+
+func (c *TableCache) lookup(id uint64) Reader {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.tables[id]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	t := elem.Value.(*tableCacheEntry).t
+	t.IncrRef()
+	return t
+}
+
+// Evict 从缓存中删除id对应的table，删除table文件前调用。
+// table的过滤器统计计入level的统计中
+func (c *TableCache) Evict(id uint64, level int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.tables[id]; ok {
+		c.removeLocked(elem)
+	}
+	if c.opts.FilterMetricsSet != nil {
+		c.opts.FilterMetricsSet.RemoveTable(level, id)
+	}
+}
+
+func (c *TableCache) removeLocked(elem *list.Element) {
+	e := elem.Value.(*tableCacheEntry)
+	c.lru.Remove(elem)
+	delete(c.tables, e.id)
+	e.t.DecrRef()
+}
+
+// Len 缓存中打开的table个数
+func (c *TableCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Close 释放缓存持有的所有table
+func (c *TableCache) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.lru.Len() > 0 {
+		c.removeLocked(c.lru.Back())
+	}
+}
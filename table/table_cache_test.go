@@ -0,0 +1,161 @@
+package table
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/YzmjY/toykv/bloomfilter"
+	"github.com/YzmjY/toykv/x"
+	"github.com/stretchr/testify/require"
+)
+
+func buildTableCacheDir(t *testing.T, n int) string {
+	dir := t.TempDir()
+	for id := 1; id <= n; id++ {
+		path := buildTestTable(t, 100*id, DefaultOptions())
+		require.NoError(t, os.Rename(path, TableFileName(dir, uint64(id))))
+	}
+	return dir
+}
+
+func TestTableCache(t *testing.T) {
+	dir := buildTableCacheDir(t, 5)
+	c := NewTableCache(dir, 2, DefaultOptions())
+	defer c.Close()
+
+	var opened []Reader
+	for round := 0; round < 2; round++ {
+		for id := 1; id <= 5; id++ {
+			tbl, err := c.Get(uint64(id), 1, 0)
+			require.NoError(t, err)
+			require.EqualValues(t, 100*id, tbl.KeyCount())
+			v, err := tbl.Get(tableKey(50))
+			require.NoError(t, err)
+			require.Equal(t, tableValue(50).Value, v.Value)
+			tbl.DecrRef()
+			require.LessOrEqual(t, c.Len(), 2)
+			opened = append(opened, tbl)
+		}
+	}
+
+	// 被淘汰的table已经关闭
+	for _, tbl := range opened[:len(opened)-2] {
+		require.Zero(t, tbl.(*Table).ref.Load())
+	}
+
+	// 命中时返回同一个table
+	a, err := c.Get(5, 1, 0)
+	require.NoError(t, err)
+	b, err := c.Get(5, 1, 0)
+	require.NoError(t, err)
+	require.Same(t, a, b)
+	a.DecrRef()
+	b.DecrRef()
+
+	_, err = c.Get(100, 1, 0)
+	require.Error(t, err)
+}
+
+func TestTableCacheIteratorKeepsTable(t *testing.T) {
+	dir := buildTableCacheDir(t, 3)
+	c := NewTableCache(dir, 1, DefaultOptions())
+	defer c.Close()
+
+	tbl, err := c.Get(1, 1, 0)
+	require.NoError(t, err)
+	iter := tbl.NewIterator(false)
+	tbl.DecrRef()
+
+	// 淘汰table 1之后迭代器仍然可以使用
+	for id := uint64(2); id <= 3; id++ {
+		other, err := c.Get(id, 1, 0)
+		require.NoError(t, err)
+		other.DecrRef()
+	}
+	c.Evict(1, 1)
+	require.EqualValues(t, 1, tbl.(*Table).ref.Load())
+
+	cnt := 0
+	for iter.Rewind(); iter.Vaild(); iter.Next() {
+		cnt++
+	}
+	require.NoError(t, iter.Error())
+	require.Equal(t, 100, cnt)
+
+	iter.Close()
+	require.Zero(t, tbl.(*Table).ref.Load())
+}
+
+func TestTableCacheConcurrent(t *testing.T) {
+	dir := buildTableCacheDir(t, 4)
+	c := NewTableCache(dir, 2, DefaultOptions())
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				id := uint64((g+i)%4 + 1)
+				tbl, err := c.Get(id, 1, 0)
+				require.NoError(t, err)
+				v, err := tbl.Get(tableKey(i % 100))
+				require.NoError(t, err)
+				require.Equal(t, tableValue(i%100).Value, v.Value)
+				tbl.DecrRef()
+			}
+		}(g)
+	}
+	wg.Wait()
+	require.LessOrEqual(t, c.Len(), 2)
+}
+
+func TestTableCacheFilterMetrics(t *testing.T) {
+	dir := buildTableCacheDir(t, 2)
+	opts := DefaultOptions()
+	opts.FilterMetricsSet = bloomfilter.NewMetricsSet()
+	c := NewTableCache(dir, 1, opts)
+	defer c.Close()
+
+	for round := 0; round < 2; round++ {
+		for id := uint64(1); id <= 2; id++ {
+			tbl, err := c.Get(id, int(id), 0)
+			require.NoError(t, err)
+			v, err := tbl.Get(x.KeyWithTs([]byte("missing"), 10))
+			require.NoError(t, err)
+			require.Nil(t, v.Value)
+			tbl.DecrRef()
+		}
+	}
+
+	// 每个table单独统计，被LRU淘汰后重新打开时继续累计
+	for id := uint64(1); id <= 2; id++ {
+		stats, ok := opts.FilterMetricsSet.Table(int(id), id)
+		require.True(t, ok)
+		require.EqualValues(t, 2, stats.Useful+stats.FalsePositive)
+	}
+
+	c.Evict(1, 1)
+	_, ok := opts.FilterMetricsSet.Table(1, 1)
+	require.False(t, ok)
+	stats := opts.FilterMetricsSet.Level(1)
+	require.EqualValues(t, 2, stats.Useful+stats.FalsePositive)
+}
+
+func TestTableCacheZeroCapacity(t *testing.T) {
+	dir := buildTableCacheDir(t, 2)
+	c := NewTableCache(dir, 0, DefaultOptions())
+	defer c.Close()
+
+	for id := uint64(1); id <= 2; id++ {
+		tbl, err := c.Get(id, 1, 0)
+		require.NoError(t, err)
+		require.Equal(t, 1, c.Len())
+		v, err := tbl.Get(tableKey(50))
+		require.NoError(t, err)
+		require.Equal(t, tableValue(50).Value, v.Value)
+		tbl.DecrRef()
+	}
+}
@@ -1 +1,222 @@
-package table
\ No newline at end of file
+package table
+
+import "github.com/YzmjY/toykv/x"
+
+// Iterator table上的两层迭代器：index block上的迭代器定位data block，
+// data block在迭代到时才加载。reversed表示迭代方向，与skiplist.UniIterator一致
+type Iterator struct {
+	t        *Table
+	reversed bool
+
+	indexIter   *indexIterator
+	blockIter   *blockIterator // 当前data block上的迭代器，未加载时为nil
+	blockHandle blockHandle
+	// file 读取data block，开启预读时为readahead
+	file blockReader
+
+	err error
+}
+
+var _ x.Iterator = &Iterator{}
+
+// NewIterator 迭代器持有table的引用，用完后必须调用Close
+func (t *Table) NewIterator(reversed bool) TableIterator {
+	t.IncrRef()
+	it := &Iterator{
+		t:        t,
+		reversed: reversed,
+		file:     t.file,
+	}
+	// 反向迭代不是顺序读，不需要预读
+	if ra := t.newReadahead(); ra != nil && !reversed {
+		it.file = ra
+	}
+	return it
+}
+
+// Error 迭代过程中遇到的错误，出错后迭代器变为无效
+func (it *Iterator) Error() error {
+	return it.err
+}
+
+// loadBlock 加载indexIter当前指向的data block
+func (it *Iterator) loadBlock() bool {
+	it.blockIter = nil
+	if !it.indexIter.Vaild() {
+		it.checkIndexError()
+		return false
+	}
+
+	it.blockIter, it.blockHandle, it.err = it.t.loadDataBlock(it.indexIter, it.file)
+	return it.err == nil
+}
+
+func (it *Iterator) checkIndexError() {
+	it.err = it.indexIter.Error()
+}
+
+func (it *Iterator) checkBlockError() bool {
+	if err := it.blockIter.Error(); err != nil {
+		it.err = it.t.corruption(it.blockHandle.offset, BlockTypeData, err)
+		return true
+	}
+	return false
+}
+
+// skipForward 当前block迭代完时移动到后面第一个非空的block
+func (it *Iterator) skipForward() {
+	for it.err == nil && (it.blockIter == nil || !it.blockIter.Vaild()) {
+		if it.blockIter != nil && it.checkBlockError() {
+			return
+		}
+		it.indexIter.Next()
+		if !it.loadBlock() {
+			return
+		}
+		it.blockIter.SeekToFirst()
+	}
+}
+
+// skipBackward 当前block迭代完时移动到前面第一个非空的block
+func (it *Iterator) skipBackward() {
+	for it.err == nil && (it.blockIter == nil || !it.blockIter.Vaild()) {
+		if it.blockIter != nil && it.checkBlockError() {
+			return
+		}
+		it.indexIter.Prev()
+		if !it.loadBlock() {
+			return
+		}
+		it.blockIter.SeekToLast()
+	}
+}
+
+func (it *Iterator) seekToFirst() {
+	it.indexIter.SeekToFirst()
+	if !it.loadBlock() {
+		return
+	}
+	it.blockIter.SeekToFirst()
+	it.skipForward()
+}
+
+func (it *Iterator) seekToLast() {
+	it.indexIter.SeekToLast()
+	if !it.loadBlock() {
+		return
+	}
+	it.blockIter.SeekToLast()
+	it.skipBackward()
+}
+
+// seek 移动到第一个大于等于key的位置
+func (it *Iterator) seek(key []byte) {
+	it.indexIter.Seek(key)
+	if !it.loadBlock() {
+		return
+	}
+	it.blockIter.Seek(key)
+	it.skipForward()
+}
+
+// seekPrev 移动到最后一个小于等于key的位置
+func (it *Iterator) seekPrev(key []byte) {
+	it.indexIter.Seek(key)
+	if !it.indexIter.Vaild() {
+		if it.checkIndexError(); it.err == nil {
+			// key比所有key都大
+			it.seekToLast()
+		}
+		return
+	}
+	if !it.loadBlock() {
+		return
+	}
+
+	it.blockIter.Seek(key)
+	if !it.blockIter.Vaild() {
+		it.blockIter.SeekToLast()
+	} else if x.KeysCompare(it.blockIter.Key(), key) > 0 {
+		it.blockIter.Prev()
+	}
+	it.skipBackward()
+}
+
+// reset 清除迭代状态，index在第一次定位时才加载
+func (it *Iterator) reset() bool {
+	it.err = nil
+	it.blockIter = nil
+	if it.indexIter == nil {
+		indexIter, err := it.t.newIndexIterator()
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.indexIter = indexIter
+	}
+	return true
+}
+
+func (it *Iterator) Rewind() {
+	if !it.reset() {
+		return
+	}
+	if it.reversed {
+		it.seekToLast()
+	} else {
+		it.seekToFirst()
+	}
+}
+
+// Seek 正向时移动到第一个大于等于key的位置，反向时移动到最后一个小于等于key的位置。
+// key不是合法的内部key时迭代器失效，Error返回x.ErrBadInternalKey
+func (it *Iterator) Seek(key []byte) {
+	if !it.reset() {
+		return
+	}
+	if _, err := x.ParseInternalKey(key); err != nil {
+		it.err = err
+		return
+	}
+	if it.reversed {
+		it.seekPrev(key)
+	} else {
+		it.seek(key)
+	}
+}
+
+func (it *Iterator) Next() {
+	if !it.Vaild() {
+		return
+	}
+
+	if it.reversed {
+		it.blockIter.Prev()
+		it.skipBackward()
+	} else {
+		it.blockIter.Next()
+		it.skipForward()
+	}
+}
+
+func (it *Iterator) Vaild() bool {
+	return it.err == nil && it.blockIter != nil && it.blockIter.Vaild()
+}
+
+func (it *Iterator) Key() []byte {
+	return it.blockIter.Key()
+}
+
+func (it *Iterator) Value() x.ValueStruct {
+	return it.blockIter.Value()
+}
+
+func (it *Iterator) Close() {
+	if it.t == nil {
+		return
+	}
+	it.t.DecrRef()
+	it.indexIter = nil
+	it.blockIter = nil
+	it.t = nil
+}
@@ -0,0 +1,108 @@
+package table
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/YzmjY/toykv/skiplist"
+	"github.com/YzmjY/toykv/x"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableIterator(t *testing.T) {
+	const n = 3000
+	opts := DefaultOptions()
+	opts.BlockSize = 256
+	tbl, err := Open(buildTestTable(t, n, opts), opts)
+	require.NoError(t, err)
+	defer tbl.Close()
+
+	it := tbl.NewIterator(false)
+	defer it.Close()
+	i := 0
+	for it.Rewind(); it.Vaild(); it.Next() {
+		require.Equal(t, tableKey(i), it.Key())
+		require.Equal(t, tableValue(i).Value, it.Value().Value)
+		i++
+	}
+	require.NoError(t, it.Error())
+	require.Equal(t, n, i)
+
+	rit := tbl.NewIterator(true)
+	defer rit.Close()
+	i = n - 1
+	for rit.Rewind(); rit.Vaild(); rit.Next() {
+		require.Equal(t, tableKey(i), rit.Key())
+		i--
+	}
+	require.Equal(t, -1, i)
+}
+
+func TestTableIteratorSeek(t *testing.T) {
+	const n = 1000
+	opts := DefaultOptions()
+	opts.BlockSize = 256
+	tbl, err := Open(buildTestTable(t, n, opts), opts)
+	require.NoError(t, err)
+	defer tbl.Close()
+
+	// 与skiplist.UniIterator的行为保持一致
+	skl := skiplist.NewSkiplist(1 << 22)
+	for i := 0; i < n; i++ {
+		skl.Put(tableKey(i), tableValue(i))
+	}
+
+	seekKeys := [][]byte{
+		x.KeyWithTs([]byte("a"), 0),
+		x.KeyWithTs([]byte("z"), 0),
+	}
+	for i := 0; i < n; i += 7 {
+		seekKeys = append(seekKeys,
+			tableKey(i),
+			x.KeyWithTs([]byte(fmt.Sprintf("key%06d", i)), 100),
+			x.KeyWithTs([]byte(fmt.Sprintf("key%06d", i)), 0),
+			x.KeyWithTs([]byte(fmt.Sprintf("key%06d_", i)), 0),
+		)
+	}
+
+	for _, reversed := range []bool{false, true} {
+		it := tbl.NewIterator(reversed)
+		sit := skl.NewUinIterator(reversed)
+		for _, key := range seekKeys {
+			it.Seek(key)
+			sit.Seek(key)
+			require.Equal(t, sit.Vaild(), it.Vaild(), "reversed=%v key=%q", reversed, key)
+			if !sit.Vaild() {
+				continue
+			}
+
+			// 从seek的位置继续迭代若干步
+			for step := 0; step < 5 && sit.Vaild(); step++ {
+				require.True(t, it.Vaild())
+				require.Equal(t, sit.Key(), it.Key())
+				require.Equal(t, sit.Value().Value, it.Value().Value)
+				it.Next()
+				sit.Next()
+			}
+		}
+		it.Close()
+		sit.Close()
+	}
+}
+
+func TestTableIteratorEmpty(t *testing.T) {
+	opts := DefaultOptions()
+	tbl, err := Open(buildTestTable(t, 0, opts), opts)
+	require.NoError(t, err)
+	defer tbl.Close()
+
+	for _, reversed := range []bool{false, true} {
+		it := tbl.NewIterator(reversed)
+		it.Rewind()
+		require.False(t, it.Vaild())
+		it.Seek(tableKey(0))
+		require.False(t, it.Vaild())
+		require.NoError(t, it.Error())
+		it.Close()
+	}
+}
@@ -0,0 +1,401 @@
+package table
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/YzmjY/toykv/bloomfilter"
+	"github.com/YzmjY/toykv/skiplist"
+	"github.com/YzmjY/toykv/x"
+	"github.com/stretchr/testify/require"
+)
+
+var fileID int
+
+// buildTestTable 生成n个key的table文件，返回文件路径
+func buildTestTable(t *testing.T, n int, opts Options) string {
+	skl := skiplist.NewSkiplist(1 << 24)
+	for i := 0; i < n; i++ {
+		skl.Put(tableKey(i), tableValue(i))
+	}
+	iter := skl.NewUinIterator(false)
+	defer iter.Close()
+
+	fileID++
+	path := filepath.Join(t.TempDir(), fmt.Sprintf("%06d.sst", fileID))
+	require.NoError(t, BuildTable(path, iter, opts))
+	return path
+}
+
+func TestTableGet(t *testing.T) {
+	const n = 10000
+	for _, partitioned := range []bool{false, true} {
+		for _, mode := range []LoadingMode{LoadingModeMmap, LoadingModePread} {
+			t.Run(fmt.Sprintf("partitioned=%v/%v", partitioned, mode), func(t *testing.T) {
+				opts := DefaultOptions()
+				opts.BlockSize = 512
+				if partitioned {
+					opts.FilterBlocksPerPartition = 4
+				}
+				path := buildTestTable(t, n, opts)
+
+				opts.LoadingMode = mode
+				opts.FilterMetrics = &bloomfilter.FilterMetrics{}
+				tbl, err := Open(path, opts)
+				require.NoError(t, err)
+				defer tbl.Close()
+
+				require.True(t, tbl.HasFilter())
+				require.EqualValues(t, n, tbl.KeyCount())
+				require.EqualValues(t, 7, tbl.MaxVersion())
+				require.Equal(t, tableKey(0), tbl.Smallest())
+				require.Equal(t, tableKey(n-1), tbl.Biggest())
+
+				for i := 0; i < n; i++ {
+					v, err := tbl.Get(x.KeyWithTs([]byte(fmt.Sprintf("key%06d", i)), 10))
+					require.NoError(t, err)
+					require.Equal(t, tableValue(i).Value, v.Value)
+					require.EqualValues(t, i%7+1, v.Version)
+				}
+
+				// 版本更小的查询看不到
+				v, err := tbl.Get(x.KeyWithTs([]byte("key000006"), 1))
+				require.NoError(t, err)
+				require.Nil(t, v.Value)
+
+				for i := 0; i < n; i++ {
+					v, err := tbl.Get(x.KeyWithTs([]byte(fmt.Sprintf("key%06d_", i)), 10))
+					require.NoError(t, err)
+					require.Nil(t, v.Value)
+				}
+
+				stats := opts.FilterMetrics.Stats()
+				require.Greater(t, stats.Useful, uint64(n*9/10))
+				require.Less(t, stats.FalsePositive, uint64(n/10))
+			})
+		}
+	}
+}
+
+func TestTableUnknownFilterPolicy(t *testing.T) {
+	opts := DefaultOptions()
+	opts.FilterPolicy = unknownPolicy{opts.FilterPolicy}
+	path := buildTestTable(t, 100, opts)
+
+	tbl, err := Open(path, DefaultOptions())
+	require.NoError(t, err)
+	defer tbl.Close()
+
+	require.False(t, tbl.HasFilter())
+	v, err := tbl.Get(tableKey(10))
+	require.NoError(t, err)
+	require.Equal(t, tableValue(10).Value, v.Value)
+}
+
+func TestTableRangeMayMatch(t *testing.T) {
+	opts := DefaultOptions()
+	opts.FilterPolicy = bloomfilter.NewRosettaFilterPoliy(16)
+	path := buildTestTable(t, 1000, opts)
+
+	for _, mode := range []LoadingMode{LoadingModeMmap, LoadingModePread} {
+		opts.LoadingMode = mode
+		tbl, err := Open(path, opts)
+		require.NoError(t, err)
+
+		require.True(t, tbl.RangeMayMatch([]byte("key000100"), []byte("key000101")))
+		require.True(t, tbl.RangeMayMatch([]byte("key"), nil))
+		require.False(t, tbl.RangeMayMatch([]byte("a"), []byte("b")))
+		require.False(t, tbl.RangeMayMatch([]byte("zzz"), nil))
+		require.NoError(t, tbl.Close())
+	}
+
+	// 不支持范围查询的过滤器不做过滤
+	opts = DefaultOptions()
+	tbl, err := Open(buildTestTable(t, 100, opts), opts)
+	require.NoError(t, err)
+	defer tbl.Close()
+	require.True(t, tbl.RangeMayMatch([]byte("a"), []byte("b")))
+}
+
+type unknownPolicy struct {
+	bloomfilter.FilterPoliy
+}
+
+func (unknownPolicy) Name() string {
+	return "unknown"
+}
+
+func TestOpenBadTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.sst")
+	require.NoError(t, os.WriteFile(path, []byte("not a table file at all, but long enough for a footer"), 0644))
+
+	_, err := Open(path, DefaultOptions())
+	require.ErrorIs(t, err, errBadMagic)
+}
+
+func TestTableCorruption(t *testing.T) {
+	opts := DefaultOptions()
+	opts.BlockSize = 512
+	path := buildTestTable(t, 1000, opts)
+
+	tbl, err := Open(path, opts)
+	require.NoError(t, err)
+	// 修改第二个data block中的一个字节
+	it := tbl.index.newIterator()
+	it.SeekToFirst()
+	it.Next()
+	h, err := decodeBlockHandle(it.RawValue())
+	require.NoError(t, err)
+	require.NoError(t, tbl.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[h.offset+h.size-10] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	for _, mode := range []LoadingMode{LoadingModeMmap, LoadingModePread} {
+		opts.LoadingMode = mode
+		tbl, err := Open(path, opts)
+		require.NoError(t, err)
+
+		// 第一个block不受影响
+		v, err := tbl.Get(tableKey(0))
+		require.NoError(t, err)
+		require.Equal(t, tableValue(0).Value, v.Value)
+
+		// 迭代到损坏的block时报错
+		iter := tbl.NewIterator(false)
+		for iter.Rewind(); iter.Vaild(); iter.Next() {
+		}
+		err = iter.Error()
+		require.ErrorIs(t, err, ErrCorruption)
+
+		var cerr *CorruptionError
+		require.ErrorAs(t, err, &cerr)
+		require.Equal(t, path, cerr.File)
+		require.Equal(t, h.offset, cerr.Offset)
+		require.Equal(t, BlockTypeData, cerr.BlockType)
+		iter.Close()
+		require.NoError(t, tbl.Close())
+	}
+
+	// 跳过校验时可以读出数据
+	opts.SkipChecksumVerification = true
+	tbl, err = Open(path, opts)
+	require.NoError(t, err)
+	defer tbl.Close()
+	iter := tbl.NewIterator(false)
+	defer iter.Close()
+	for iter.Rewind(); iter.Vaild(); iter.Next() {
+	}
+	require.NoError(t, iter.Error())
+}
+
+func TestTableCorruptedIndex(t *testing.T) {
+	opts := DefaultOptions()
+	path := buildTestTable(t, 1000, opts)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	f, err := decodeFooter(data[len(data)-footerSize:])
+	require.NoError(t, err)
+	data[f.index.offset] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	_, err = Open(path, opts)
+	var cerr *CorruptionError
+	require.ErrorAs(t, err, &cerr)
+	require.Equal(t, BlockTypeIndex, cerr.BlockType)
+	require.ErrorIs(t, err, errChecksumMismatch)
+}
+
+func TestTableValueChecksums(t *testing.T) {
+	for _, format := range []TableFormat{BlockBasedFormat, PlainFormat} {
+		opts := DefaultOptions()
+		opts.Compression = NoCompression
+		opts.Format = format
+		opts.ValueChecksums = true
+		path := buildTestTable(t, 100, opts)
+
+		r, err := OpenReader(path, opts)
+		require.NoError(t, err)
+		v, err := r.Get(tableKey(42))
+		require.NoError(t, err)
+		require.Equal(t, tableValue(42).Value, v.Value)
+		require.NotZero(t, v.Meta&x.BitChecksum)
+		require.NoError(t, r.Close())
+
+		// 破坏一个value，跳过block的checksum，由value的checksum发现
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		i := bytes.Index(data, []byte("value42"))
+		require.Positive(t, i)
+		data[i] ^= 0xff
+		require.NoError(t, os.WriteFile(path, data, 0644))
+
+		opts.SkipChecksumVerification = true
+		r, err = OpenReader(path, opts)
+		require.NoError(t, err)
+		_, err = r.Get(tableKey(42))
+		require.ErrorIs(t, err, x.ErrChecksumMismatch, format)
+		require.ErrorIs(t, err, ErrCorruption)
+
+		it := r.NewIterator(false)
+		for it.Rewind(); it.Vaild(); it.Next() {
+		}
+		require.ErrorIs(t, it.Error(), x.ErrChecksumMismatch)
+		it.Close()
+		require.NoError(t, r.Close())
+	}
+}
+
+func TestTableMalformedValue(t *testing.T) {
+	for _, format := range []TableFormat{BlockBasedFormat, PlainFormat} {
+		opts := DefaultOptions()
+		opts.Compression = NoCompression
+		opts.Format = format
+		path := buildTestTable(t, 100, opts)
+
+		// 把ExpiresAt和value都改成0xff，varint一直没有结束
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		i := bytes.Index(data, []byte("value42"))
+		require.Positive(t, i)
+		copy(data[i-1:], bytes.Repeat([]byte{0xff}, len("value42")+1))
+		require.NoError(t, os.WriteFile(path, data, 0644))
+
+		opts.SkipChecksumVerification = true
+		r, err := OpenReader(path, opts)
+		require.NoError(t, err)
+		_, err = r.Get(tableKey(42))
+		require.ErrorIs(t, err, x.ErrBadValue, format)
+		require.ErrorIs(t, err, ErrCorruption)
+		require.NoError(t, r.Close())
+	}
+}
+
+func TestTableBadKeyType(t *testing.T) {
+	for _, format := range []TableFormat{BlockBasedFormat, PlainFormat} {
+		opts := DefaultOptions()
+		opts.Compression = NoCompression
+		opts.Format = format
+		path := buildTestTable(t, 100, opts)
+
+		// 把key000042中的操作类型改成不存在的值，block中只保存了与前一个key不同的后缀
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		suffix := append([]byte("2"), x.KeyWithTs(nil, 42%7+1)...)
+		i := bytes.Index(data, suffix)
+		require.Positive(t, i)
+		data[i+len(suffix)-1] = 0x77
+		require.NoError(t, os.WriteFile(path, data, 0644))
+
+		opts.SkipChecksumVerification = true
+		r, err := OpenReader(path, opts)
+		require.NoError(t, err)
+		it := r.NewIterator(false)
+		for it.Rewind(); it.Vaild(); it.Next() {
+		}
+		require.ErrorIs(t, it.Error(), x.ErrBadInternalKey, format)
+		require.ErrorIs(t, it.Error(), ErrCorruption)
+		it.Close()
+		require.NoError(t, r.Close())
+	}
+}
+
+func TestTableHandleOverflow(t *testing.T) {
+	for _, mode := range []LoadingMode{LoadingModeMmap, LoadingModePread} {
+		opts := DefaultOptions()
+		opts.LoadingMode = mode
+		tbl, err := Open(buildTestTable(t, 100, opts), opts)
+		require.NoError(t, err)
+
+		// size加上trailer之后溢出
+		h := blockHandle{offset: 0, size: math.MaxUint64 - 2}
+		_, err = tbl.readBlock(h, BlockTypeData)
+		require.ErrorIs(t, err, ErrCorruption)
+		if ra := tbl.newReadahead(); ra != nil {
+			_, err = tbl.readBlockFrom(ra, h, BlockTypeData)
+			require.ErrorIs(t, err, ErrCorruption)
+		}
+		require.NoError(t, tbl.Close())
+	}
+}
+
+func TestTableCloseTwice(t *testing.T) {
+	opts := DefaultOptions()
+	tbl, err := Open(buildTestTable(t, 100, opts), opts)
+	require.NoError(t, err)
+
+	it := tbl.NewIterator(false)
+	it.Rewind()
+	require.NoError(t, tbl.Close())
+	require.NoError(t, tbl.Close())
+	// 迭代器持有的引用保证文件仍然可读
+	require.True(t, it.Vaild())
+	require.Equal(t, tableKey(0), it.Key())
+	it.Close()
+	it.Close()
+
+	require.ErrorIs(t, tbl.decrRef(), errRefUnderflow)
+}
+
+func TestTableUnknownFormatVersion(t *testing.T) {
+	for _, opts := range []Options{DefaultOptions(), plainOptions()} {
+		path := buildTestTable(t, 10, opts)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		// 两种footer中version都位于magic之前
+		binary.LittleEndian.PutUint32(data[len(data)-12:], 99)
+		require.NoError(t, os.WriteFile(path, data, 0644))
+
+		_, err = OpenReader(path, opts)
+		require.ErrorIs(t, err, errBadVersion)
+	}
+}
+
+func TestTableBadLookupKey(t *testing.T) {
+	badType := x.KeyWithTs([]byte("key000010"), 1)
+	badType[len(badType)-1] = 0x77
+
+	// 全局版本要求文件中的版本都是0
+	globalPath := filepath.Join(t.TempDir(), "ext.sst")
+	writePlain(t, globalPath, DefaultOptions())
+	globalOpts := DefaultOptions()
+	globalOpts.GlobalVersion = 10
+
+	for _, c := range []struct {
+		path string
+		opts Options
+	}{
+		{buildTestTable(t, 100, DefaultOptions()), DefaultOptions()},
+		{buildTestTable(t, 100, plainOptions()), plainOptions()},
+		{globalPath, globalOpts},
+	} {
+		r, err := OpenReader(c.path, c.opts)
+		require.NoError(t, err)
+
+		for _, key := range [][]byte{nil, []byte("a"), badType} {
+			_, err := r.Get(key)
+			require.ErrorIs(t, err, x.ErrBadInternalKey)
+
+			for _, reversed := range []bool{false, true} {
+				it := r.NewIterator(reversed)
+				it.Seek(key)
+				require.False(t, it.Vaild())
+				require.ErrorIs(t, it.Error(), x.ErrBadInternalKey)
+				// 之后的定位不受影响
+				it.Rewind()
+				require.True(t, it.Vaild())
+				require.NoError(t, it.Error())
+				it.Close()
+			}
+		}
+		require.NoError(t, r.Close())
+	}
+}
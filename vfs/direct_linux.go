@@ -0,0 +1,23 @@
+//go:build linux
+
+package vfs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// openDirect 以O_DIRECT打开文件，文件系统不支持时（例如tmpfs）退化为普通的打开方式，
+// 返回的direct表示是否使用了O_DIRECT
+func openDirect(path string) (f *os.File, direct bool, err error) {
+	f, err = os.OpenFile(path, os.O_RDONLY|syscall.O_DIRECT, 0)
+	if err == nil {
+		return f, true, nil
+	}
+	if !errors.Is(err, syscall.EINVAL) {
+		return nil, false, err
+	}
+	f, err = os.Open(path)
+	return f, false, err
+}
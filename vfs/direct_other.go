@@ -0,0 +1,11 @@
+//go:build !linux
+
+package vfs
+
+import "os"
+
+// openDirect 只有linux支持O_DIRECT，其他平台上退化为普通的打开方式
+func openDirect(path string) (*os.File, bool, error) {
+	f, err := os.Open(path)
+	return f, false, err
+}
@@ -0,0 +1,359 @@
+package vfs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// ErrInjected FaultFS注入的错误，可以用errors.Is(err, syscall.EIO)判断
+var ErrInjected = fmt.Errorf("vfs: injected fault: %w", syscall.EIO)
+
+// Op FaultFS上的操作类型，用于选择注入错误的位置
+type Op int
+
+const (
+	OpCreate Op = iota
+	OpOpen
+	OpRead
+	OpWrite
+	OpSync
+	OpRemove
+	OpRename
+	OpLink
+	OpStat
+	OpMkdir
+	OpList
+	OpSyncDir
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpCreate:
+		return "create"
+	case OpOpen:
+		return "open"
+	case OpRead:
+		return "read"
+	case OpWrite:
+		return "write"
+	case OpSync:
+		return "sync"
+	case OpRemove:
+		return "remove"
+	case OpRename:
+		return "rename"
+	case OpLink:
+		return "link"
+	case OpStat:
+		return "stat"
+	case OpMkdir:
+		return "mkdir"
+	case OpList:
+		return "list"
+	case OpSyncDir:
+		return "syncdir"
+	default:
+		return fmt.Sprintf("Op(%d)", int(op))
+	}
+}
+
+// FaultFS 包装另一个FS，按需注入错误，并记录通过它写入的文件sync到了哪里，
+// 用DropUnsyncedWrites模拟崩溃后未sync的数据丢失。
+// 创建、链接和重命名产生的目录项在SyncDir之前同样会丢失；删除视为立即持久化，
+// 被重命名覆盖的文件也不会在崩溃后恢复
+type FaultFS struct {
+	fs FS
+
+	mu sync.Mutex
+	// synced 通过FaultFS创建的文件已经sync的长度
+	synced map[string]int64
+	// entries 所在目录还没有sync的目录项，值为崩溃后恢复成的名字，为空表示崩溃后不存在
+	entries map[string]string
+	// writeLimit 总共写入这么多字节后写入失败，小于0时不限制
+	writeLimit int64
+	written    int64
+	inject     func(op Op, name string) bool
+}
+
+var _ FS = &FaultFS{}
+
+func NewFaultFS(fs FS) *FaultFS {
+	return &FaultFS{
+		fs:         fs,
+		synced:     make(map[string]int64),
+		entries:    make(map[string]string),
+		writeLimit: -1,
+	}
+}
+
+// SetWriteLimit 从现在开始再写入n字节之后，所有的写入都返回ErrInjected，
+// 跨过限制的那次写入只写入限制以内的部分。n小于0时取消限制
+func (fs *FaultFS) SetWriteLimit(n int64) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.writeLimit, fs.written = n, 0
+}
+
+// InjectErrors fn返回true的操作不会执行，返回ErrInjected。fn为nil时取消注入
+func (fs *FaultFS) InjectErrors(fn func(op Op, name string) bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.inject = fn
+}
+
+func (fs *FaultFS) injected(op Op, name string) error {
+	fs.mu.Lock()
+	fn := fs.inject
+	fs.mu.Unlock()
+	if fn != nil && fn(op, name) {
+		return &os.PathError{Op: op.String(), Path: name, Err: ErrInjected}
+	}
+	return nil
+}
+
+// DropUnsyncedWrites 撤销没有SyncDir的目录项，并把通过FaultFS写入的文件截断到
+// 最后一次sync时的长度，模拟崩溃。调用之前打开的文件不能再使用
+func (fs *FaultFS) DropUnsyncedWrites() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for name, orig := range fs.entries {
+		size, tracked := fs.synced[name]
+		delete(fs.synced, name)
+		if orig == "" {
+			if err := fs.fs.Remove(name); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fs.fs.Rename(name, orig); err != nil {
+			return err
+		}
+		if tracked {
+			fs.synced[orig] = size
+		}
+	}
+	clear(fs.entries)
+
+	for name, size := range fs.synced {
+		if err := truncate(fs.fs, name, size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncate FS没有截断操作，读出前size个字节后重新创建文件
+func truncate(fs FS, name string, size int64) error {
+	f, err := fs.Open(name)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(f, data)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := fs.Remove(name); err != nil {
+		return err
+	}
+	out, err := fs.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(data); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (fs *FaultFS) Create(name string) (File, error) {
+	if err := fs.injected(OpCreate, name); err != nil {
+		return nil, err
+	}
+	f, err := fs.fs.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	name = cleanPath(name)
+	fs.mu.Lock()
+	fs.synced[name] = 0
+	fs.entries[name] = ""
+	fs.mu.Unlock()
+	return &faultFile{File: f, fs: fs, name: name}, nil
+}
+
+func (fs *FaultFS) Open(name string) (File, error) {
+	if err := fs.injected(OpOpen, name); err != nil {
+		return nil, err
+	}
+	f, err := fs.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: f, fs: fs, name: cleanPath(name)}, nil
+}
+
+func (fs *FaultFS) Remove(name string) error {
+	if err := fs.injected(OpRemove, name); err != nil {
+		return err
+	}
+	if err := fs.fs.Remove(name); err != nil {
+		return err
+	}
+	name = cleanPath(name)
+	fs.mu.Lock()
+	delete(fs.synced, name)
+	delete(fs.entries, name)
+	fs.mu.Unlock()
+	return nil
+}
+
+func (fs *FaultFS) Rename(oldname, newname string) error {
+	if err := fs.injected(OpRename, oldname); err != nil {
+		return err
+	}
+	if err := fs.fs.Rename(oldname, newname); err != nil {
+		return err
+	}
+	oldname, newname = cleanPath(oldname), cleanPath(newname)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	delete(fs.synced, newname)
+	if size, ok := fs.synced[oldname]; ok {
+		delete(fs.synced, oldname)
+		fs.synced[newname] = size
+	}
+	// 崩溃后回到重命名之前的名字，oldname本身也没有持久化时一起消失
+	orig, ok := fs.entries[oldname]
+	if !ok {
+		orig = oldname
+	}
+	delete(fs.entries, oldname)
+	fs.entries[newname] = orig
+	return nil
+}
+
+func (fs *FaultFS) Link(oldname, newname string) error {
+	if err := fs.injected(OpLink, oldname); err != nil {
+		return err
+	}
+	if err := fs.fs.Link(oldname, newname); err != nil {
+		return err
+	}
+	oldname, newname = cleanPath(oldname), cleanPath(newname)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	// 两个名字指向同一个文件，截断时各自按原来的sync位置处理
+	if size, ok := fs.synced[oldname]; ok {
+		fs.synced[newname] = size
+	}
+	fs.entries[newname] = ""
+	return nil
+}
+
+func (fs *FaultFS) Stat(name string) (os.FileInfo, error) {
+	if err := fs.injected(OpStat, name); err != nil {
+		return nil, err
+	}
+	return fs.fs.Stat(name)
+}
+
+func (fs *FaultFS) MkdirAll(dir string, perm os.FileMode) error {
+	if err := fs.injected(OpMkdir, dir); err != nil {
+		return err
+	}
+	return fs.fs.MkdirAll(dir, perm)
+}
+
+func (fs *FaultFS) List(dir string) ([]string, error) {
+	if err := fs.injected(OpList, dir); err != nil {
+		return nil, err
+	}
+	return fs.fs.List(dir)
+}
+
+func (fs *FaultFS) SyncDir(dir string) error {
+	if err := fs.injected(OpSyncDir, dir); err != nil {
+		return err
+	}
+	if err := fs.fs.SyncDir(dir); err != nil {
+		return err
+	}
+	dir = cleanPath(dir)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for name := range fs.entries {
+		if filepath.Dir(name) == dir {
+			delete(fs.entries, name)
+		}
+	}
+	return nil
+}
+
+type faultFile struct {
+	File
+	fs   *FaultFS
+	name string
+	size int64 // 已经写入的字节数
+}
+
+func (f *faultFile) Read(p []byte) (int, error) {
+	if err := f.fs.injected(OpRead, f.name); err != nil {
+		return 0, err
+	}
+	return f.File.Read(p)
+}
+
+func (f *faultFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.fs.injected(OpRead, f.name); err != nil {
+		return 0, err
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	if err := f.fs.injected(OpWrite, f.name); err != nil {
+		return 0, err
+	}
+
+	f.fs.mu.Lock()
+	allowed := int64(len(p))
+	if f.fs.writeLimit >= 0 {
+		allowed = min(allowed, max(f.fs.writeLimit-f.fs.written, 0))
+	}
+	f.fs.written += allowed
+	f.fs.mu.Unlock()
+
+	n, err := f.File.Write(p[:allowed])
+	f.size += int64(n)
+	if err == nil && allowed < int64(len(p)) {
+		err = &os.PathError{Op: "write", Path: f.name, Err: ErrInjected}
+	}
+	return n, err
+}
+
+func (f *faultFile) Sync() error {
+	if err := f.fs.injected(OpSync, f.name); err != nil {
+		return err
+	}
+	if err := f.File.Sync(); err != nil {
+		return err
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if _, ok := f.fs.synced[f.name]; ok {
+		f.fs.synced[f.name] = f.size
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package vfs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultFSDropUnsynced(t *testing.T) {
+	fs := NewFaultFS(NewMemFS())
+	f, err := fs.Create("/db/000001.log")
+	require.NoError(t, err)
+	require.NoError(t, fs.SyncDir("/db"))
+	_, err = f.Write([]byte("synced"))
+	require.NoError(t, err)
+	require.NoError(t, f.Sync())
+	_, err = f.Write([]byte("-lost"))
+	require.NoError(t, err)
+
+	g, err := fs.Create("/db/tmp")
+	require.NoError(t, err)
+	_, err = g.Write([]byte("never synced"))
+	require.NoError(t, err)
+	require.NoError(t, fs.Rename("/db/tmp", "/db/000002.sst"))
+
+	require.NoError(t, fs.DropUnsyncedWrites())
+	require.Equal(t, "synced", readFile(t, fs, "/db/000001.log"))
+	// 目录没有sync，重命名后的文件也不存在
+	_, err = fs.Stat("/db/000002.sst")
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestFaultFSDirEntries(t *testing.T) {
+	fs := NewFaultFS(NewMemFS())
+	writeFile(t, fs, "/ext/a.sst", "data")
+	require.NoError(t, fs.SyncDir("/ext"))
+
+	// 链接和重命名在SyncDir之前崩溃会被撤销
+	require.NoError(t, fs.Link("/ext/a.sst", "/db/000001.sst"))
+	require.NoError(t, fs.Rename("/ext/a.sst", "/db/000002.sst"))
+	require.NoError(t, fs.DropUnsyncedWrites())
+	_, err := fs.Stat("/db/000001.sst")
+	require.True(t, os.IsNotExist(err))
+	_, err = fs.Stat("/db/000002.sst")
+	require.True(t, os.IsNotExist(err))
+	require.Equal(t, "data", readFile(t, fs, "/ext/a.sst"))
+
+	require.NoError(t, fs.Link("/ext/a.sst", "/db/000001.sst"))
+	require.NoError(t, fs.Rename("/ext/a.sst", "/db/000002.sst"))
+	require.NoError(t, fs.SyncDir("/db"))
+	require.NoError(t, fs.DropUnsyncedWrites())
+	require.Equal(t, "data", readFile(t, fs, "/db/000001.sst"))
+	require.Equal(t, "data", readFile(t, fs, "/db/000002.sst"))
+	_, err = fs.Stat("/ext/a.sst")
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestFaultFSWriteLimit(t *testing.T) {
+	fs := NewFaultFS(NewMemFS())
+	fs.SetWriteLimit(10)
+	f, err := fs.Create("a")
+	require.NoError(t, err)
+	n, err := f.Write([]byte("0123456"))
+	require.NoError(t, err)
+	require.Equal(t, 7, n)
+	n, err = f.Write([]byte("789abc"))
+	require.ErrorIs(t, err, ErrInjected)
+	require.Equal(t, 3, n)
+	_, err = f.Write([]byte("d"))
+	require.ErrorIs(t, err, syscall.EIO)
+	require.NoError(t, f.Close())
+	require.Equal(t, "0123456789", readFile(t, fs, "a"))
+
+	fs.SetWriteLimit(-1)
+	writeFile(t, fs, "b", "unlimited")
+}
+
+func TestFaultFSInjectErrors(t *testing.T) {
+	fs := NewFaultFS(NewMemFS())
+	writeFile(t, fs, "a", "data")
+	fs.InjectErrors(func(op Op, name string) bool {
+		return op == OpSync || (op == OpRead && name == "a")
+	})
+
+	f, err := fs.Open("a")
+	require.NoError(t, err)
+	_, err = f.ReadAt(make([]byte, 1), 0)
+	require.True(t, errors.Is(err, syscall.EIO))
+	require.NoError(t, f.Close())
+
+	g, err := fs.Create("b")
+	require.NoError(t, err)
+	require.ErrorIs(t, g.Sync(), ErrInjected)
+	require.NoError(t, g.Close())
+
+	fs.InjectErrors(nil)
+	require.Equal(t, "data", readFile(t, fs, "a"))
+}
@@ -0,0 +1,248 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemFS 内存中的文件系统。目录是隐式的，创建文件时不要求父目录存在；
+// Sync不做任何事，配合FaultFS模拟丢失未sync的数据
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string]*memNode
+	dirs  map[string]bool
+}
+
+var _ FS = &MemFS{}
+
+func NewMemFS() *MemFS {
+	return &MemFS{
+		files: make(map[string]*memNode),
+		dirs:  make(map[string]bool),
+	}
+}
+
+// memNode 文件的内容，硬链接的多个名字共享同一个memNode
+type memNode struct {
+	mu      sync.RWMutex
+	data    []byte
+	modTime time.Time
+}
+
+func (fs *MemFS) Create(name string) (File, error) {
+	name = cleanPath(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.files[name]; ok {
+		return nil, &os.PathError{Op: "create", Path: name, Err: os.ErrExist}
+	}
+	n := &memNode{modTime: time.Now()}
+	fs.files[name] = n
+	return &memFile{name: name, n: n, write: true}, nil
+}
+
+func (fs *MemFS) Open(name string) (File, error) {
+	n, err := fs.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &memFile{name: cleanPath(name), n: n}, nil
+}
+
+func (fs *MemFS) lookup(op, name string) (*memNode, error) {
+	name = cleanPath(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	n, ok := fs.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return n, nil
+}
+
+func (fs *MemFS) Remove(name string) error {
+	name = cleanPath(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.files[name]; ok {
+		delete(fs.files, name)
+		return nil
+	}
+	if fs.dirs[name] {
+		delete(fs.dirs, name)
+		return nil
+	}
+	return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+}
+
+func (fs *MemFS) Rename(oldname, newname string) error {
+	oldname, newname = cleanPath(oldname), cleanPath(newname)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	n, ok := fs.files[oldname]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	delete(fs.files, oldname)
+	fs.files[newname] = n
+	return nil
+}
+
+func (fs *MemFS) Link(oldname, newname string) error {
+	oldname, newname = cleanPath(oldname), cleanPath(newname)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	n, ok := fs.files[oldname]
+	if !ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	if _, ok := fs.files[newname]; ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+	fs.files[newname] = n
+	return nil
+}
+
+func (fs *MemFS) Stat(name string) (os.FileInfo, error) {
+	name = cleanPath(name)
+	fs.mu.Lock()
+	n, ok := fs.files[name]
+	isDir := fs.dirs[name]
+	fs.mu.Unlock()
+	if ok {
+		return n.stat(name), nil
+	}
+	if isDir {
+		return &memFileInfo{name: filepath.Base(name), dir: true}, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+}
+
+func (fs *MemFS) MkdirAll(dir string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for dir = cleanPath(dir); !fs.dirs[dir]; dir = filepath.Dir(dir) {
+		fs.dirs[dir] = true
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+	return nil
+}
+
+func (fs *MemFS) List(dir string) ([]string, error) {
+	dir = cleanPath(dir)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var names []string
+	for name := range fs.files {
+		if filepath.Dir(name) == dir {
+			names = append(names, filepath.Base(name))
+		}
+	}
+	for name := range fs.dirs {
+		if name != dir && filepath.Dir(name) == dir {
+			names = append(names, filepath.Base(name))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (n *memNode) stat(name string) os.FileInfo {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return &memFileInfo{name: filepath.Base(name), size: int64(len(n.data)), modTime: n.modTime}
+}
+
+type memFile struct {
+	name   string
+	n      *memNode
+	write  bool
+	pos    int64 // Read的位置
+	closed bool
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.pos)
+	f.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: os.ErrClosed}
+	}
+	f.n.mu.RLock()
+	defer f.n.mu.RUnlock()
+	if off >= int64(len(f.n.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.n.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if f.closed || !f.write {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: os.ErrClosed}
+	}
+	f.n.mu.Lock()
+	defer f.n.mu.Unlock()
+	f.n.data = append(f.n.data, p...)
+	f.n.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Close() error {
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.name, Err: os.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	return f.n.stat(f.name), nil
+}
+
+func (f *memFile) Sync() error {
+	if f.closed {
+		return &os.PathError{Op: "sync", Path: f.name, Err: os.ErrClosed}
+	}
+	return nil
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *memFileInfo) IsDir() bool        { return fi.dir }
+func (fi *memFileInfo) Sys() any           { return nil }
+
+func (fi *memFileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+// SyncDir MemFS中的修改总是立即可见，不需要持久化
+func (fs *MemFS) SyncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,69 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, fs FS, name, data string) {
+	f, err := fs.Create(name)
+	require.NoError(t, err)
+	_, err = f.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, f.Sync())
+	require.NoError(t, f.Close())
+}
+
+func readFile(t *testing.T, fs FS, name string) string {
+	f, err := fs.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestFS(t *testing.T) {
+	for name, fs := range map[string]FS{"os": Default, "mem": NewMemFS()} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, fs.MkdirAll(dir+"/sub", 0755))
+			writeFile(t, fs, dir+"/a", "hello")
+			require.Equal(t, "hello", readFile(t, fs, dir+"/a"))
+
+			_, err := fs.Create(dir + "/a")
+			require.True(t, os.IsExist(err))
+			_, err = fs.Open(dir + "/missing")
+			require.True(t, os.IsNotExist(err))
+
+			f, err := fs.Open(dir + "/a")
+			require.NoError(t, err)
+			buf := make([]byte, 3)
+			n, err := f.ReadAt(buf, 3)
+			require.Equal(t, 2, n)
+			require.Equal(t, io.EOF, err)
+			fi, err := f.Stat()
+			require.NoError(t, err)
+			require.EqualValues(t, 5, fi.Size())
+			require.NoError(t, f.Close())
+
+			require.NoError(t, fs.Link(dir+"/a", dir+"/b"))
+			require.NoError(t, fs.Rename(dir+"/b", dir+"/c"))
+			require.NoError(t, CopyFile(fs, dir+"/c", dir+"/d"))
+			names, err := fs.List(dir)
+			require.NoError(t, err)
+			require.Equal(t, []string{"a", "c", "d", "sub"}, names)
+
+			require.NoError(t, fs.Remove(dir+"/a"))
+			require.Equal(t, "hello", readFile(t, fs, dir+"/c"))
+			_, err = fs.Stat(dir + "/a")
+			require.True(t, os.IsNotExist(err))
+			fi, err = fs.Stat(dir + "/d")
+			require.NoError(t, err)
+			require.EqualValues(t, 5, fi.Size())
+		})
+	}
+}
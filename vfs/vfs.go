@@ -0,0 +1,141 @@
+// Package vfs 存储引擎访问文件的接口。引擎中所有的文件操作都通过FS进行，
+// 测试时可以换成MemFS或者FaultFS，在进程内模拟崩溃和IO错误
+package vfs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// File 打开的文件。Create得到的文件只能顺序写，Open得到的文件只读
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.Closer
+	Stat() (os.FileInfo, error)
+	// Sync 写入的数据持久化之后才返回
+	Sync() error
+}
+
+// FS 文件系统，出错时返回*os.PathError，可以用os.IsNotExist等函数判断
+type FS interface {
+	// Create 创建一个新文件用于写入，文件已经存在时返回os.ErrExist
+	Create(name string) (File, error)
+	// Open 以只读方式打开文件
+	Open(name string) (File, error)
+	Remove(name string) error
+	// Rename newname已经存在时会被替换
+	Rename(oldname, newname string) error
+	// Link 创建硬链接，不支持时返回错误，调用方可以退化为拷贝
+	Link(oldname, newname string) error
+	Stat(name string) (os.FileInfo, error)
+	MkdirAll(dir string, perm os.FileMode) error
+	// List dir下的文件名，不包括目录部分，按名字排序
+	List(dir string) ([]string, error)
+	// SyncDir 持久化dir中的目录项，创建、链接和重命名的文件在这之后才不会因为崩溃丢失
+	SyncDir(dir string) error
+}
+
+// Default 操作系统的文件系统，Open和Create返回的是*os.File
+var Default FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) Create(name string) (File, error) {
+	return os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+}
+
+func (osFS) Open(name string) (File, error) {
+	return os.Open(name)
+}
+
+func (osFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFS) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+func (osFS) Link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+func (osFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFS) MkdirAll(dir string, perm os.FileMode) error {
+	return os.MkdirAll(dir, perm)
+}
+
+func (osFS) List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (osFS) SyncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// OpenDirect 以O_DIRECT只读打开文件，只有Default在支持的平台和文件系统上生效，
+// 其余情况退化为fs.Open，返回的direct表示是否使用了O_DIRECT
+func OpenDirect(fs FS, name string) (f File, direct bool, err error) {
+	if _, ok := fs.(osFS); !ok {
+		f, err = fs.Open(name)
+		return f, false, err
+	}
+	of, direct, err := openDirect(name)
+	if err != nil {
+		return nil, false, err
+	}
+	return of, direct, nil
+}
+
+// CopyFile 把src拷贝为新文件dst并sync，失败时删除dst
+func CopyFile(fs FS, src, dst string) (err error) {
+	in, err := fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := fs.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			fs.Remove(dst)
+		}
+	}()
+
+	if _, err = io.Copy(out, in); err != nil {
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func cleanPath(name string) string {
+	return filepath.Clean(name)
+}
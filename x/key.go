@@ -3,40 +3,169 @@ package x
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"math"
 )
 
-// KeyWithTs userKey+timestamp:其中timestamp表示版本，用MaxUint64减一下
-// 目的在于：拿较小的时间戳查询时，不应该查询到大时间戳即在此之后的版本，所以时间戳小的反而优先级高
-// 在跳表的后面
+// 内部key的格式为 userKey | trailer(8字节，BigEndian)，
+// trailer的高56位为MaxVersion-version，低8位为ValueType。
+// 版本取反的目的在于：拿较小的版本查询时，不应该查询到在此之后的版本，所以版本大的排在前面。
+// 比较时只看userKey和版本，同一个userKey的同一个版本只会有一个操作
+
+// ValueType 内部key中记录的操作类型
+type ValueType uint8
+
+const (
+	ValueTypeDelete ValueType = iota
+	ValueTypeValue
+	ValueTypeMerge
+	ValueTypeRangeDelete
+	ValueTypeSingleDelete
+
+	maxValueType = ValueTypeSingleDelete
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case ValueTypeDelete:
+		return "delete"
+	case ValueTypeValue:
+		return "value"
+	case ValueTypeMerge:
+		return "merge"
+	case ValueTypeRangeDelete:
+		return "range-delete"
+	case ValueTypeSingleDelete:
+		return "single-delete"
+	default:
+		return fmt.Sprintf("ValueType(%d)", uint8(t))
+	}
+}
+
+// MaxVersion 版本只占用trailer的高56位
+const MaxVersion uint64 = 1<<56 - 1
+
+const trailerSize = 8
+
+var (
+	ErrBadInternalKey = errors.New("x: malformed internal key")
+	// ErrVersionTooLarge 版本超出了MaxVersion，不能编码到内部key中
+	ErrVersionTooLarge = errors.New("x: version exceeds MaxVersion")
+)
+
+// CheckVersion 检查调用方给出的版本能否编码到内部key中。
+// math.MaxUint64表示最新的版本，编码为MaxVersion；其他大于MaxVersion的版本返回ErrVersionTooLarge
+func CheckVersion(version uint64) error {
+	if version > MaxVersion && version != math.MaxUint64 {
+		return fmt.Errorf("%w: %d", ErrVersionTooLarge, version)
+	}
+	return nil
+}
+
+// NewInternalKey 把userKey、版本和操作类型编码成内部key，版本的规则见CheckVersion
+func NewInternalKey(userKey []byte, version uint64, typ ValueType) ([]byte, error) {
+	AssertTrue(typ <= maxValueType)
+	if err := CheckVersion(version); err != nil {
+		return nil, err
+	}
+	version = min(version, MaxVersion)
+	out := make([]byte, len(userKey)+trailerSize)
+	copy(out, userKey)
+	binary.BigEndian.PutUint64(out[len(userKey):], (MaxVersion-version)<<8|uint64(typ))
+	return out, nil
+}
+
+// MakeInternalKey 与NewInternalKey相同，版本不合法时panic，用于已经检查过的版本
+func MakeInternalKey(userKey []byte, version uint64, typ ValueType) []byte {
+	out, err := NewInternalKey(userKey, version, typ)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// KeyWithTs 类型为ValueTypeValue的内部key，ts表示版本
 func KeyWithTs(key []byte, ts uint64) []byte {
-	out := make([]byte, len(key)+8)
-	copy(out, key)
-	binary.BigEndian.PutUint64(out[len(key):], math.MaxUint64-ts)
+	return MakeInternalKey(key, ts, ValueTypeValue)
+}
+
+// WithValueType 返回把key中的操作类型替换为typ后的拷贝
+func WithValueType(key []byte, typ ValueType) []byte {
+	AssertTrue(len(key) >= trailerSize && typ <= maxValueType)
+	out := append([]byte(nil), key...)
+	out[len(out)-1] = byte(typ)
 	return out
 }
 
+// ParseTs ParseUserKey ParseValueType 用于可信的内部key，格式不对时直接退出，
+// 来自磁盘等外部的key使用ParseInternalKey
 func ParseTs(key []byte) uint64 {
-	AssertTrue(len(key) >= 8)
-	return math.MaxUint64 - binary.BigEndian.Uint64(key[len(key)-8:])
+	AssertTrue(len(key) >= trailerSize)
+	return MaxVersion - binary.BigEndian.Uint64(key[len(key)-trailerSize:])>>8
 }
 
 func ParseUserKey(key []byte) []byte {
-	AssertTrue(len(key) >= 8)
-	return key[:len(key)-8]
+	AssertTrue(len(key) >= trailerSize)
+	return key[:len(key)-trailerSize]
+}
+
+func ParseValueType(key []byte) ValueType {
+	AssertTrue(len(key) >= trailerSize)
+	return ValueType(key[len(key)-1])
+}
+
+// ParsedInternalKey 解析后的内部key，UserKey引用原来的key
+type ParsedInternalKey struct {
+	UserKey []byte
+	Version uint64
+	Type    ValueType
+}
+
+func (k ParsedInternalKey) Encode() []byte {
+	return MakeInternalKey(k.UserKey, k.Version, k.Type)
+}
+
+// ParseInternalKey 解析并校验内部key
+func ParseInternalKey(key []byte) (ParsedInternalKey, error) {
+	if len(key) < trailerSize {
+		return ParsedInternalKey{}, fmt.Errorf("%w: length %d", ErrBadInternalKey, len(key))
+	}
+	trailer := binary.BigEndian.Uint64(key[len(key)-trailerSize:])
+	typ := ValueType(trailer & 0xff)
+	if typ > maxValueType {
+		return ParsedInternalKey{}, fmt.Errorf("%w: unknown %v", ErrBadInternalKey, typ)
+	}
+	return ParsedInternalKey{
+		UserKey: key[:len(key)-trailerSize],
+		Version: MaxVersion - trailer>>8,
+		Type:    typ,
+	}, nil
 }
 
 // KeysCompare compare key ,return
 // lhs == rhs : 0
 // lhs < rhs : -1
 // lhs > rhs : 1
+// 只比较userKey和版本，不比较操作类型
 func KeysCompare(lhs, rhs []byte) int {
 	l := len(lhs)
 	r := len(rhs)
-	if cmp := bytes.Compare(lhs[:l-8], rhs[:r-8]); cmp != 0 {
+	if cmp := bytes.Compare(lhs[:l-trailerSize], rhs[:r-trailerSize]); cmp != 0 {
 		return cmp
 	}
-	return bytes.Compare(lhs[l-8:], rhs[r-8:])
+	return bytes.Compare(lhs[l-trailerSize:l-1], rhs[r-trailerSize:r-1])
+}
+
+// CompareInternalKeys 校验两个内部key后再比较，结果与KeysCompare相同
+func CompareInternalKeys(lhs, rhs []byte) (int, error) {
+	if _, err := ParseInternalKey(lhs); err != nil {
+		return 0, err
+	}
+	if _, err := ParseInternalKey(rhs); err != nil {
+		return 0, err
+	}
+	return KeysCompare(lhs, rhs), nil
 }
 
 func SameUserKey(lhs, rhs []byte) bool {
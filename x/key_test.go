@@ -0,0 +1,83 @@
+package x
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInternalKey(t *testing.T) {
+	for _, typ := range []ValueType{ValueTypeDelete, ValueTypeValue, ValueTypeMerge, ValueTypeRangeDelete, ValueTypeSingleDelete} {
+		for _, version := range []uint64{0, 1, 1 << 40, MaxVersion} {
+			key := MakeInternalKey([]byte("user"), version, typ)
+			parsed, err := ParseInternalKey(key)
+			require.NoError(t, err)
+			require.Equal(t, ParsedInternalKey{UserKey: []byte("user"), Version: version, Type: typ}, parsed)
+			require.Equal(t, key, parsed.Encode())
+
+			require.Equal(t, version, ParseTs(key))
+			require.Equal(t, typ, ParseValueType(key))
+			require.Equal(t, []byte("user"), ParseUserKey(key))
+		}
+	}
+	require.Equal(t, ValueTypeValue, ParseValueType(KeyWithTs([]byte("a"), 3)))
+	require.Equal(t, ValueTypeMerge, ParseValueType(WithValueType(KeyWithTs([]byte("a"), 3), ValueTypeMerge)))
+}
+
+func TestInternalKeyCompare(t *testing.T) {
+	// userKey升序，版本降序，不比较操作类型
+	keys := [][]byte{
+		MakeInternalKey([]byte("a"), 5, ValueTypeValue),
+		MakeInternalKey([]byte("a"), 3, ValueTypeDelete),
+		MakeInternalKey([]byte("a"), 0, ValueTypeMerge),
+		MakeInternalKey([]byte("ab"), MaxVersion, ValueTypeValue),
+		MakeInternalKey([]byte("b"), 1, ValueTypeSingleDelete),
+	}
+	for i := range keys {
+		for j := range keys {
+			cmp, err := CompareInternalKeys(keys[i], keys[j])
+			require.NoError(t, err)
+			switch {
+			case i < j:
+				require.Equal(t, -1, cmp)
+			case i > j:
+				require.Equal(t, 1, cmp)
+			default:
+				require.Equal(t, 0, cmp)
+			}
+		}
+	}
+	cmp, err := CompareInternalKeys(
+		MakeInternalKey([]byte("a"), 3, ValueTypeValue), MakeInternalKey([]byte("a"), 3, ValueTypeDelete))
+	require.NoError(t, err)
+	require.Zero(t, cmp)
+}
+
+func TestParseInternalKeyErrors(t *testing.T) {
+	_, err := ParseInternalKey([]byte("short"))
+	require.ErrorIs(t, err, ErrBadInternalKey)
+
+	key := KeyWithTs([]byte("a"), 1)
+	key[len(key)-1] = 0x77
+	_, err = ParseInternalKey(key)
+	require.ErrorIs(t, err, ErrBadInternalKey)
+	_, err = CompareInternalKeys(KeyWithTs([]byte("a"), 1), key)
+	require.ErrorIs(t, err, ErrBadInternalKey)
+}
+
+func TestInternalKeyMaxVersion(t *testing.T) {
+	// math.MaxUint64表示最新的版本，常用于查找最新版本
+	k := KeyWithTs([]byte("k"), math.MaxUint64)
+	require.Equal(t, KeyWithTs([]byte("k"), MaxVersion), k)
+	require.Equal(t, MaxVersion, ParseTs(k))
+	require.Negative(t, KeysCompare(k, KeyWithTs([]byte("k"), MaxVersion-1)))
+
+	// 其他超出56位的版本不能编码，不会和MaxVersion混在一起
+	for _, version := range []uint64{MaxVersion + 1, math.MaxUint64 - 1} {
+		require.ErrorIs(t, CheckVersion(version), ErrVersionTooLarge)
+		_, err := NewInternalKey([]byte("k"), version, ValueTypeValue)
+		require.ErrorIs(t, err, ErrVersionTooLarge)
+		require.Panics(t, func() { KeyWithTs([]byte("k"), version) })
+	}
+}
@@ -1,6 +1,29 @@
 package x
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+const (
+	// BitDelete 删除标记，表示key已经被删除
+	BitDelete byte = 1 << 0
+	// BitChecksum 编码后的value末尾带有4字节的crc32c，覆盖前面所有的字节。
+	// 写入方设置这一位来开启value的校验，memtable、WAL、value log和table都可以使用；
+	// 这一位是Meta的一部分，Decode原样返回，再次Encode时重新计算checksum
+	BitChecksum byte = 1 << 1
+
+	checksumSize = 4
+)
+
+var (
+	ErrBadValue         = errors.New("x: malformed value")
+	ErrChecksumMismatch = errors.New("x: value checksum mismatch")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
 
 // ValueStruct represents the value info that can be associated with a key, but also the internal
 // Meta field.
@@ -14,7 +37,11 @@ type ValueStruct struct {
 }
 
 func (v *ValueStruct) EncodeSize() uint32 {
-	return uint32(len(v.Value) + sizeVarint(v.ExpiresAt) + 2)
+	size := len(v.Value) + sizeVarint(v.ExpiresAt) + 2
+	if v.Meta&BitChecksum != 0 {
+		size += checksumSize
+	}
+	return uint32(size)
 }
 
 func sizeVarint(x uint64) int {
@@ -36,17 +63,67 @@ func (v *ValueStruct) Encode(dst []byte) uint32 {
 	vSize := binary.PutUvarint(dst[2:], v.ExpiresAt)
 
 	copy(dst[2+vSize:], v.Value)
+	if v.Meta&BitChecksum != 0 {
+		end := need - checksumSize
+		binary.LittleEndian.PutUint32(dst[end:], crc32.Checksum(dst[:end], castagnoli))
+	}
 	return uint32(need)
 }
 
+// Decode 解码可信的数据，例如内存中或者已经用DecodeChecked校验过的value，不校验checksum。
+// 数据格式不对说明调用方用错了，直接panic
 func (v *ValueStruct) Decode(src []byte) {
+	if err := v.decode(src, false); err != nil {
+		panic(fmt.Sprintf("x: Decode of malformed value %x: %v", src, err))
+	}
+}
+
+// DecodeChecked 解码来自磁盘等不可信来源的数据，检查长度、varint溢出以及checksum，
+// 出错时v不变
+func (v *ValueStruct) DecodeChecked(src []byte) error {
+	return v.decode(src, true)
+}
+
+func (v *ValueStruct) decode(src []byte, verify bool) error {
 	if len(src) < 2 {
-		panic("len(src) must be gt 2")
+		return ErrBadValue
+	}
+	// n为0表示数据不完整，小于0表示溢出
+	expiresAt, n := binary.Uvarint(src[2:])
+	if n <= 0 {
+		return ErrBadValue
+	}
+	value := src[2+n:]
+	if src[0]&BitChecksum != 0 {
+		if len(value) < checksumSize {
+			return ErrBadValue
+		}
+		if verify {
+			if err := VerifyValue(src); err != nil {
+				return err
+			}
+		}
+		value = value[:len(value)-checksumSize]
 	}
+
 	v.Meta = src[0]
 	v.UserMeta = src[1]
+	v.ExpiresAt = expiresAt
+	v.Value = value
+	return nil
+}
 
-	var size int
-	v.ExpiresAt, size = binary.Uvarint(src[2:])
-	v.Value = src[2+size:]
+// VerifyValue 校验编码后的value中的checksum，没有设置BitChecksum时总是返回nil
+func VerifyValue(src []byte) error {
+	if len(src) == 0 || src[0]&BitChecksum == 0 {
+		return nil
+	}
+	if len(src) < 2+1+checksumSize {
+		return ErrChecksumMismatch
+	}
+	end := len(src) - checksumSize
+	if binary.LittleEndian.Uint32(src[end:]) != crc32.Checksum(src[:end], castagnoli) {
+		return ErrChecksumMismatch
+	}
+	return nil
 }
@@ -0,0 +1,93 @@
+package x
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueChecksum(t *testing.T) {
+	for _, v := range []ValueStruct{
+		{Meta: BitChecksum, Value: []byte("hello")},
+		{Meta: BitChecksum | BitDelete, UserMeta: 3, ExpiresAt: 1 << 40},
+		{Meta: BitDelete, Value: []byte("no checksum")},
+	} {
+		buf := make([]byte, v.EncodeSize())
+		require.EqualValues(t, len(buf), v.Encode(buf))
+		require.NoError(t, VerifyValue(buf))
+
+		var got ValueStruct
+		got.Decode(buf)
+		require.Equal(t, v.Meta, got.Meta)
+		require.Equal(t, v.UserMeta, got.UserMeta)
+		require.Equal(t, v.ExpiresAt, got.ExpiresAt)
+		require.Equal(t, string(v.Value), string(got.Value))
+
+		// 修改任意一个字节都能发现
+		if v.Meta&BitChecksum != 0 {
+			for i := 1; i < len(buf); i++ {
+				buf[i] ^= 0x10
+				require.ErrorIs(t, VerifyValue(buf), ErrChecksumMismatch)
+				buf[i] ^= 0x10
+			}
+		}
+	}
+}
+
+func TestDecodeChecked(t *testing.T) {
+	for _, src := range [][]byte{
+		nil,
+		{0},
+		{0, 0},
+		{0, 0, 0x80},
+		{0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}, // varint溢出
+		{BitChecksum, 0, 0, 'a'},
+	} {
+		v := ValueStruct{Value: []byte("unchanged")}
+		require.ErrorIs(t, v.DecodeChecked(src), ErrBadValue, "%x", src)
+		require.Equal(t, "unchanged", string(v.Value))
+	}
+
+	var v ValueStruct
+	require.NoError(t, v.DecodeChecked([]byte{BitDelete, 7, 0x80, 0x01, 'v'}))
+	require.Equal(t, ValueStruct{Meta: BitDelete, UserMeta: 7, ExpiresAt: 128, Value: []byte("v")}, v)
+}
+
+func FuzzValueStructRoundTrip(f *testing.F) {
+	f.Add(byte(0), byte(0), uint64(0), []byte(nil))
+	f.Add(BitDelete, byte(1), uint64(1<<63), []byte("value"))
+	f.Add(BitChecksum, byte(0xff), uint64(300), []byte{0, 1, 2})
+	f.Fuzz(func(t *testing.T, meta, userMeta byte, expiresAt uint64, value []byte) {
+		v := ValueStruct{Meta: meta, UserMeta: userMeta, ExpiresAt: expiresAt, Value: value}
+		buf := make([]byte, v.EncodeSize())
+		require.EqualValues(t, len(buf), v.Encode(buf))
+
+		var got ValueStruct
+		require.NoError(t, got.DecodeChecked(buf))
+		require.Equal(t, meta, got.Meta)
+		require.Equal(t, userMeta, got.UserMeta)
+		require.Equal(t, expiresAt, got.ExpiresAt)
+		require.Equal(t, string(value), string(got.Value))
+	})
+}
+
+func FuzzDecodeChecked(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 0})
+	f.Add([]byte{BitChecksum, 0, 0x80, 0x80, 1, 2, 3, 4, 5})
+	f.Fuzz(func(t *testing.T, src []byte) {
+		var v ValueStruct
+		if v.DecodeChecked(src) != nil {
+			return
+		}
+		// 能解码的数据重新编码后得到同样的值，非最短的varint编码长度可能不同
+		buf := make([]byte, v.EncodeSize())
+		v.Encode(buf)
+		var got ValueStruct
+		require.NoError(t, got.DecodeChecked(buf))
+		require.Equal(t, v.Meta, got.Meta)
+		require.Equal(t, v.ExpiresAt, got.ExpiresAt)
+		require.Equal(t, string(v.Value), string(got.Value))
+		require.LessOrEqual(t, len(buf), len(src))
+	})
+}